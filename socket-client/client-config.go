@@ -0,0 +1,83 @@
+package socketclient
+
+import (
+	"crypto/ed25519"
+	"crypto/tls"
+	"time"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+)
+
+const (
+	TransportTCP       = "tcp"
+	TransportTLS       = "tls"
+	TransportWebSocket = "ws"
+	TransportKCP       = "kcp"
+)
+
+// 客戶端設定，未設定的欄位會使用預設值
+type Config struct {
+	Address   string      // 伺服器位址，WebSocket 時為完整網址，例: ws://127.0.0.1:8310/ws
+	Transport string      // 傳輸方式: tcp, tls, ws, kcp
+	TLSConfig *tls.Config // tls 或 wss 使用的 TLS 設定
+
+	Encryption        bool   // 伺服器是否啟用封包加密
+	Codec             string // 請求資料編碼，需與伺服器一致或經由 Hello 協商
+	ServerCodec       string // 伺服器預設的請求資料編碼，設定 Hello 時協商完成前使用
+	Compression       string // 發送封包的壓縮方式
+	CompressThreshold int
+	MaxFrameSize      int
+
+	ServerKey ed25519.PublicKey // 伺服器簽署金鑰交換的公鑰，設定後拒絕未簽章或簽章錯誤的伺服器
+
+	Hello  *HelloInfo // 連線後進行版本協商，nil 為不協商
+	Resume bool       // 伺服器啟用斷線重連時，重新連線後恢復原本的連線狀態
+
+	DialTimeout      time.Duration
+	HandshakeTimeout time.Duration
+	CallTimeout      time.Duration // Call 的 context 未設定期限時使用的超時
+
+	Reconnect        bool          // 斷線後自動重新連線
+	ReconnectMinWait time.Duration // 重新連線的最短等待時間
+	ReconnectMaxWait time.Duration // 重新連線的最長等待時間
+	MaxReconnect     int           // 連續重新連線失敗次數上限，0 為不限制
+
+	Logger *logger.Logger // nil 為不記錄
+}
+
+// 版本協商資訊
+type HelloInfo struct {
+	ProtocolVersion int
+	ClientBuild     int
+	Platform        string
+}
+
+func (config *Config) setDefault() {
+	if config.Transport == "" {
+		config.Transport = TransportTCP
+	}
+	if config.Codec == "" {
+		config.Codec = "json"
+	}
+	if config.ServerCodec == "" {
+		config.ServerCodec = "json"
+	}
+	if config.Compression == "" {
+		config.Compression = "none"
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = time.Second * 5
+	}
+	if config.HandshakeTimeout <= 0 {
+		config.HandshakeTimeout = time.Second * 5
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = time.Second * 10
+	}
+	if config.ReconnectMinWait <= 0 {
+		config.ReconnectMinWait = time.Millisecond * 500
+	}
+	if config.ReconnectMaxWait <= 0 {
+		config.ReconnectMaxWait = time.Second * 30
+	}
+}
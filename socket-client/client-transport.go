@@ -0,0 +1,67 @@
+package socketclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/xtaci/kcp-go/v5"
+	"golang.org/x/net/websocket"
+)
+
+// 依照設定的傳輸方式建立連線
+func dialTransport(ctx context.Context, config *Config) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.DialTimeout)
+	defer cancel()
+
+	switch config.Transport {
+	case TransportTCP:
+		dialer := &net.Dialer{}
+		return dialer.DialContext(ctx, "tcp", config.Address)
+	case TransportTLS:
+		dialer := &tls.Dialer{Config: config.TLSConfig}
+		return dialer.DialContext(ctx, "tcp", config.Address)
+	case TransportWebSocket:
+		return dialWebSocket(config)
+	case TransportKCP:
+		session, err := kcp.DialWithOptions(config.Address, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		session.SetStreamMode(true)
+		session.SetNoDelay(1, 10, 2, 1)
+		return session, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrTransportInvalid, config.Transport)
+}
+
+func dialWebSocket(config *Config) (net.Conn, error) {
+	location, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := &url.URL{Scheme: "http", Host: location.Host}
+	if location.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+
+	wsConfig, err := websocket.NewConfig(location.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	wsConfig.TlsConfig = config.TLSConfig
+	wsConfig.Dialer = &net.Dialer{Timeout: config.DialTimeout}
+
+	ws, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
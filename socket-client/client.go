@@ -0,0 +1,708 @@
+package socketclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+	socketserver "github.com/andy2kuo/AndyGameServerGo/socket-server"
+)
+
+var ErrClientClosed error = errors.New("socket client closed")
+var ErrDisconnected error = errors.New("socket client disconnected")
+var ErrTransportInvalid error = errors.New("transport invalid")
+var ErrKicked error = errors.New("kicked by server")
+
+// 伺服器推送處理函式，同一個客戶端的推送依照收到的順序逐一處理
+type PushHandler func(*socketserver.SocketRequest)
+
+// 連線成功時呼叫，可用於重新登入等初始化流程
+type ConnectHandler func(*Client) error
+
+type handlerKey struct {
+	opCode  socketserver.OperationCode
+	cmdCode socketserver.CommandCode
+	allCmd  bool
+}
+
+// 版本協商失敗
+type HelloError struct {
+	Result     socketserver.HelloResult
+	Message    string
+	UpgradeURL string
+}
+
+func (e *HelloError) Error() string {
+	return fmt.Sprintf("hello fail. result = %v, message = %v", e.Result, e.Message)
+}
+
+// 伺服器以錯誤回覆請求
+type ServerError struct {
+	Code    socketserver.ErrorCode
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error. code = %v, message = %v", e.Code, e.Message)
+}
+
+// 將系統錯誤回覆轉為錯誤
+func responseError(res *socketserver.SocketRequest) error {
+	if res.OperationCode() != socketserver.OpCodeSystem || res.CommandCode() != socketserver.CmdError {
+		return nil
+	}
+
+	code, _ := res.GetInt64(socketserver.DataCodeErrorCode)
+	message, _ := res.GetString(socketserver.DataCodeMessage)
+	return &ServerError{Code: socketserver.ErrorCode(code), Message: message}
+}
+
+// Socket 客戶端
+type Client struct {
+	sync.RWMutex
+
+	config Config
+	logger *logger.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	session   *session      // 目前的連線，斷線時為 nil
+	ready     chan struct{} // 連線建立通知
+	reqSerial uint32        // 請求編號，重新連線後仍持續遞增
+
+	resumeToken string // 伺服器發放的恢復連線憑證
+
+	handlers  map[handlerKey]PushHandler
+	onConnect []ConnectHandler
+	onResume  []ConnectHandler
+	onKick    []func(message string)
+	pushQueue chan *socketserver.SocketRequest
+}
+
+// 單次連線
+type session struct {
+	conn      net.Conn
+	packer    *socketserver.Packer
+	writeLock sync.Mutex
+
+	pendingLock sync.Mutex
+	pending     map[socketserver.ReqID]chan *socketserver.SocketRequest
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// 產生新的客戶端，需呼叫 Connect 才會建立連線
+func New(config Config) *Client {
+	config.setDefault()
+
+	client := &Client{
+		config:    config,
+		logger:    config.Logger,
+		ready:     make(chan struct{}),
+		handlers:  make(map[handlerKey]PushHandler),
+		pushQueue: make(chan *socketserver.SocketRequest, 256),
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+
+	go client.dispatchPush()
+
+	return client
+}
+
+// 產生新的客戶端並建立連線
+func Dial(ctx context.Context, config Config) (*Client, error) {
+	client := New(config)
+	if err := client.Connect(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// 建立連線，啟用自動重新連線時會在斷線後持續重試
+func (client *Client) Connect(ctx context.Context) error {
+	s, err := client.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	go client.maintain(s)
+	return nil
+}
+
+// 註冊指定流程與指令的推送處理函式
+func (client *Client) Handle(opCode socketserver.OperationCode, cmdCode socketserver.CommandCode, handler PushHandler) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.handlers[handlerKey{opCode: opCode, cmdCode: cmdCode}] = handler
+}
+
+// 註冊指定流程所有指令的推送處理函式，指定指令的處理函式優先
+func (client *Client) HandleOperation(opCode socketserver.OperationCode, handler PushHandler) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.handlers[handlerKey{opCode: opCode, allCmd: true}] = handler
+}
+
+// 註冊連線成功 (包含重新連線) 時的處理函式
+func (client *Client) OnConnect(handler ConnectHandler) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.onConnect = append(client.onConnect, handler)
+}
+
+// 註冊恢復原本連線狀態時的處理函式，恢復成功時不會呼叫 OnConnect 的處理函式
+func (client *Client) OnResume(handler ConnectHandler) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.onResume = append(client.onResume, handler)
+}
+
+// 註冊被伺服器踢除時的處理函式，被踢除後不會重新連線
+func (client *Client) OnKick(handler func(message string)) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.onKick = append(client.onKick, handler)
+}
+
+// 發送請求並等待回覆，伺服器以錯誤回覆時回傳 *ServerError
+func (client *Client) Call(ctx context.Context, opCode socketserver.OperationCode, cmdCode socketserver.CommandCode, reqData socketserver.ReqData) (*socketserver.SocketRequest, error) {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.config.CallTimeout)
+		defer cancel()
+	}
+
+	s, err := client.waitSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.call(ctx, s, opCode, cmdCode, reqData)
+}
+
+// 發送心跳並回傳來回延遲
+func (client *Client) Ping(ctx context.Context) (time.Duration, error) {
+	startTime := time.Now()
+	if _, err := client.Call(ctx, socketserver.OpCodeSystem, socketserver.CmdPing, socketserver.ReqData{}); err != nil {
+		return 0, err
+	}
+
+	return time.Since(startTime), nil
+}
+
+// 發送請求但不等待回覆，伺服器的回覆會交由推送處理函式處理
+func (client *Client) Send(opCode socketserver.OperationCode, cmdCode socketserver.CommandCode, reqData socketserver.ReqData) error {
+	client.RLock()
+	s := client.session
+	client.RUnlock()
+
+	if s == nil {
+		return ErrDisconnected
+	}
+
+	return s.write(0, opCode, cmdCode, reqData)
+}
+
+// 是否已連線
+func (client *Client) IsConnected() bool {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.session != nil
+}
+
+// 關閉客戶端，不再重新連線
+func (client *Client) Close() error {
+	client.cancel()
+
+	client.Lock()
+	s := client.session
+	client.session = nil
+	client.Unlock()
+
+	if s != nil {
+		s.close(ErrClientClosed)
+	}
+
+	return nil
+}
+
+// 建立一次連線，包含金鑰交換與版本協商
+func (client *Client) connect(ctx context.Context) (*session, error) {
+	conn, err := dialTransport(ctx, &client.config)
+	if err != nil {
+		return nil, err
+	}
+
+	packer, err := client.newPacker()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if client.config.Encryption {
+		frameCipher, err := socketserver.ClientHandshake(conn, client.config.ServerKey, client.config.HandshakeTimeout)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		packer.SetCipher(frameCipher)
+	}
+
+	s := &session{
+		conn:    conn,
+		packer:  packer,
+		pending: make(map[socketserver.ReqID]chan *socketserver.SocketRequest),
+		done:    make(chan struct{}),
+	}
+
+	go client.readLoop(s)
+
+	if client.config.Hello != nil {
+		if err = client.hello(ctx, s); err != nil {
+			s.close(err)
+			return nil, err
+		}
+	}
+
+	resumed := false
+	if client.config.Resume {
+		if resumed, err = client.resume(ctx, s); err != nil {
+			s.close(err)
+			return nil, err
+		}
+	}
+
+	client.Lock()
+	client.session = s
+	close(client.ready)
+	handlers := append([]ConnectHandler{}, client.onConnect...)
+	if resumed {
+		handlers = append([]ConnectHandler{}, client.onResume...)
+	}
+	client.Unlock()
+
+	for _, handler := range handlers {
+		if err = handler(client); err != nil {
+			client.logWarn(fmt.Sprintf("Socket client on connect fail. %v", err.Error()))
+		}
+	}
+
+	return s, nil
+}
+
+func (client *Client) newPacker() (*socketserver.Packer, error) {
+	packer := socketserver.NewPacket(nil)
+
+	codec, err := socketserver.GetCodec(client.config.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	// 協商完成前伺服器以預設編碼解析，要求的編碼只放在 Hello 內容中
+	if client.config.Hello != nil {
+		codec, err = socketserver.GetCodec(client.config.ServerCodec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	packer.SetCodec(codec)
+
+	err = packer.SetCompression(client.config.Compression, client.config.CompressThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.config.MaxFrameSize > 0 {
+		packer.SetMaxFrameSize(client.config.MaxFrameSize)
+	}
+
+	return packer, nil
+}
+
+// 版本協商，成功後切換為伺服器同意的編碼
+func (client *Client) hello(ctx context.Context, s *session) error {
+	ctx, cancel := context.WithTimeout(ctx, client.config.HandshakeTimeout)
+	defer cancel()
+
+	// 伺服器回覆後即以新的編碼發送，需在讀取端解析出回覆時切換，之後的封包才能正確解析
+	s.packer.SetCodecSwitch(func(res *socketserver.SocketRequest) socketserver.ICodec {
+		if res.OperationCode() != socketserver.OpCodeSystem || res.CommandCode() != socketserver.CmdHello {
+			return nil
+		}
+
+		codecName, _ := res.GetString(socketserver.DataCodeCodec)
+		codec, err := socketserver.GetCodec(codecName)
+		if err != nil {
+			return nil
+		}
+
+		return codec
+	})
+
+	res, err := client.call(ctx, s, socketserver.OpCodeSystem, socketserver.CmdHello, socketserver.ReqData{
+		socketserver.DataCodeProtocolVersion: client.config.Hello.ProtocolVersion,
+		socketserver.DataCodeClientBuild:     client.config.Hello.ClientBuild,
+		socketserver.DataCodePlatform:        client.config.Hello.Platform,
+		socketserver.DataCodeCodec:           client.config.Codec,
+	})
+	if err != nil {
+		return err
+	}
+
+	result, _ := res.GetInt64(socketserver.DataCodeHelloResult)
+	if socketserver.HelloResult(result) != socketserver.HelloAccept {
+		message, _ := res.GetString(socketserver.DataCodeMessage)
+		upgradeURL, _ := res.GetString(socketserver.DataCodeUpgradeURL)
+		return &HelloError{Result: socketserver.HelloResult(result), Message: message, UpgradeURL: upgradeURL}
+	}
+
+	// 編碼已在讀取端切換，此處只確認伺服器同意的編碼可以使用
+	if codecName, _ := res.GetString(socketserver.DataCodeCodec); codecName != "" {
+		if _, err := socketserver.GetCodec(codecName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 以先前取得的憑證恢復連線狀態，沒有憑證時通知伺服器以新的連線狀態開始
+func (client *Client) resume(ctx context.Context, s *session) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, client.config.HandshakeTimeout)
+	defer cancel()
+
+	client.RLock()
+	token := client.resumeToken
+	client.RUnlock()
+
+	res, err := client.call(ctx, s, socketserver.OpCodeSystem, socketserver.CmdResume, socketserver.ReqData{
+		socketserver.DataCodeResumeToken: token,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	result, _ := res.GetInt64(socketserver.DataCodeResumeResult)
+	if socketserver.ResumeResult(result) != socketserver.ResumeSuccess {
+		return false, nil
+	}
+
+	if token, _ = res.GetString(socketserver.DataCodeResumeToken); token != "" {
+		client.setResumeToken(token)
+	}
+
+	return true, nil
+}
+
+func (client *Client) setResumeToken(token string) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.resumeToken = token
+}
+
+// 維持連線，斷線後依照設定以指數退避重新連線
+func (client *Client) maintain(s *session) {
+	for {
+		select {
+		case <-s.done:
+		case <-client.ctx.Done():
+			return
+		}
+
+		client.Lock()
+		if client.session == s {
+			client.session = nil
+			client.ready = make(chan struct{})
+		}
+		client.Unlock()
+
+		if client.ctx.Err() != nil {
+			return
+		}
+
+		client.logWarn(fmt.Sprintf("Socket client disconnected. %v", s.err))
+		if !client.config.Reconnect || errors.Is(s.err, ErrKicked) {
+			client.Close()
+			return
+		}
+
+		var err error
+		for retry := 1; ; retry++ {
+			select {
+			case <-time.After(client.backoff(retry)):
+			case <-client.ctx.Done():
+				return
+			}
+
+			s, err = client.connect(client.ctx)
+			if err == nil {
+				client.logInfo(fmt.Sprintf("Socket client reconnected after %v retry", retry))
+				break
+			}
+
+			var helloErr *HelloError
+			if errors.As(err, &helloErr) || (client.config.MaxReconnect > 0 && retry >= client.config.MaxReconnect) {
+				client.logWarn(fmt.Sprintf("Socket client stop reconnect. %v", err.Error()))
+				client.Close()
+				return
+			}
+
+			client.logWarn(fmt.Sprintf("Socket client reconnect fail. retry = %v, error = %v", retry, err.Error()))
+		}
+	}
+}
+
+// 計算第 retry 次重新連線前的等待時間，加入隨機抖動避免同時重連
+func (client *Client) backoff(retry int) time.Duration {
+	wait := client.config.ReconnectMinWait
+	for i := 1; i < retry && wait < client.config.ReconnectMaxWait; i++ {
+		wait *= 2
+	}
+
+	if wait > client.config.ReconnectMaxWait {
+		wait = client.config.ReconnectMaxWait
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// 等待連線建立
+func (client *Client) waitSession(ctx context.Context) (*session, error) {
+	for {
+		client.RLock()
+		s, ready := client.session, client.ready
+		client.RUnlock()
+
+		if s != nil {
+			return s, nil
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-client.ctx.Done():
+			return nil, ErrClientClosed
+		}
+	}
+}
+
+func (client *Client) call(ctx context.Context, s *session, opCode socketserver.OperationCode, cmdCode socketserver.CommandCode, reqData socketserver.ReqData) (*socketserver.SocketRequest, error) {
+	reqID := client.nextRequestID()
+	response := s.register(reqID)
+	defer s.unregister(reqID)
+
+	if err := s.write(reqID, opCode, cmdCode, reqData); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-response:
+		return res, responseError(res)
+	case <-s.done:
+		return nil, fmt.Errorf("%w: %v", ErrDisconnected, s.err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 產生下一個請求編號，跳過 0
+func (client *Client) nextRequestID() socketserver.ReqID {
+	for {
+		if id := socketserver.ReqID(atomic.AddUint32(&client.reqSerial, 1)); id != 0 {
+			return id
+		}
+	}
+}
+
+// 接收封包
+func (client *Client) readLoop(s *session) {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := s.conn.Read(buffer)
+		if err != nil {
+			s.close(err)
+			return
+		}
+
+		err = s.packer.Add(buffer[:n])
+		if err != nil {
+			client.logWarn(fmt.Sprintf("Socket client unpack fail. %v", err.Error()))
+
+			var frameErr *socketserver.FrameError
+			if errors.As(err, &frameErr) && frameErr.Fatal {
+				s.close(err)
+				return
+			}
+		}
+
+		for s.packer.Done() {
+			res := s.packer.Get()
+
+			// 伺服器的心跳編號與此端的請求編號各自遞增，需在對應回覆前處理
+			if res.OperationCode() == socketserver.OpCodeSystem && res.CommandCode() == socketserver.CmdPing {
+				if err := s.write(res.GetID(), socketserver.OpCodeSystem, socketserver.CmdPong, socketserver.ReqData{}); err != nil {
+					client.logWarn(fmt.Sprintf("Socket client pong fail. %v", err.Error()))
+				}
+				continue
+			}
+
+			if res.GetID() != 0 && s.deliver(res) {
+				continue
+			}
+
+			if res.OperationCode() == socketserver.OpCodeSystem {
+				if client.handleSystemPush(s, res) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case client.pushQueue <- res:
+			case <-client.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// 處理系統推送，回傳連線是否已結束
+func (client *Client) handleSystemPush(s *session, res *socketserver.SocketRequest) bool {
+	switch res.CommandCode() {
+	case socketserver.CmdResumeToken:
+		token, _ := res.GetString(socketserver.DataCodeResumeToken)
+		client.setResumeToken(token)
+	case socketserver.CmdKick:
+		message, _ := res.GetString(socketserver.DataCodeMessage)
+
+		client.RLock()
+		handlers := append([]func(string){}, client.onKick...)
+		client.RUnlock()
+
+		for _, handler := range handlers {
+			handler(message)
+		}
+
+		s.close(fmt.Errorf("%w: %v", ErrKicked, message))
+		return true
+	case socketserver.CmdError:
+		client.logWarn(fmt.Sprintf("Socket client request fail. %v", responseError(res)))
+	case socketserver.CmdServerClosing:
+		message, _ := res.GetString(socketserver.DataCodeMessage)
+		client.logInfo(fmt.Sprintf("Socket server closing. %v", message))
+	default:
+		client.logWarn(fmt.Sprintf("Socket client system push not handled. Cmd code = %v", res.CommandCode()))
+	}
+
+	return false
+}
+
+// 依序處理伺服器推送
+func (client *Client) dispatchPush() {
+	for {
+		select {
+		case <-client.ctx.Done():
+			return
+		case res := <-client.pushQueue:
+			client.RLock()
+			handler, isExist := client.handlers[handlerKey{opCode: res.OperationCode(), cmdCode: res.CommandCode()}]
+			if !isExist {
+				handler, isExist = client.handlers[handlerKey{opCode: res.OperationCode(), allCmd: true}]
+			}
+			client.RUnlock()
+
+			if isExist {
+				handler(res)
+			} else {
+				client.logWarn(fmt.Sprintf("Socket client push handler not exist. Op code = %v, Cmd code = %v", res.OperationCode(), res.CommandCode()))
+			}
+		}
+	}
+}
+
+func (client *Client) logInfo(message string) {
+	if client.logger != nil {
+		client.logger.Info(message)
+	}
+}
+
+func (client *Client) logWarn(message string) {
+	if client.logger != nil {
+		client.logger.Warn(message)
+	}
+}
+
+func (s *session) register(reqID socketserver.ReqID) chan *socketserver.SocketRequest {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	response := make(chan *socketserver.SocketRequest, 1)
+	s.pending[reqID] = response
+	return response
+}
+
+func (s *session) unregister(reqID socketserver.ReqID) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	delete(s.pending, reqID)
+}
+
+// 將回覆交給等待中的請求，沒有對應的請求時回傳 false
+func (s *session) deliver(res *socketserver.SocketRequest) bool {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	response, isExist := s.pending[res.GetID()]
+	if isExist {
+		response <- res
+		delete(s.pending, res.GetID())
+	}
+
+	return isExist
+}
+
+// 打包並發送封包，加密時 nonce 順序必須與寫入順序一致，因此整段加鎖
+func (s *session) write(reqID socketserver.ReqID, opCode socketserver.OperationCode, cmdCode socketserver.CommandCode, reqData socketserver.ReqData) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	byteData, err := s.packer.PackFrame(reqID, time.Now(), opCode, cmdCode, reqData)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn.Write(byteData)
+	if err != nil {
+		s.close(err)
+	}
+
+	return err
+}
+
+func (s *session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		s.conn.Close()
+		close(s.done)
+	})
+}
@@ -0,0 +1,266 @@
+package socketclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+	socketserver "github.com/andy2kuo/AndyGameServerGo/socket-server"
+)
+
+// 測試用伺服器，回覆請求並在指令 2 時額外推送一筆資料，收到的心跳回覆編號送入 pongs
+func startFakeServer(t *testing.T) (net.Listener, chan net.Conn, chan socketserver.ReqID) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns := make(chan net.Conn, 8)
+	pongs := make(chan socketserver.ReqID, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+
+			go func(conn net.Conn) {
+				packer := socketserver.NewPacket(nil)
+				buffer := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buffer)
+					if err != nil {
+						return
+					}
+
+					packer.Add(buffer[:n])
+					for packer.Done() {
+						req := packer.Get()
+						if req.OperationCode() == socketserver.OpCodeSystem {
+							switch req.CommandCode() {
+							case socketserver.CmdPong:
+								pongs <- req.GetID()
+								continue
+							case socketserver.CmdPing:
+								res, _ := packer.PackFrame(req.GetID(), time.Now(), socketserver.OpCodeSystem, socketserver.CmdPong, socketserver.ReqData{})
+								conn.Write(res)
+								continue
+							}
+						}
+
+						if req.CommandCode() == 2 {
+							push, _ := packer.PackData(time.Now(), req.OperationCode(), 3, socketserver.ReqData{0: "push"})
+							conn.Write(push)
+						}
+
+						res, _ := packer.PackRequest(req)
+						conn.Write(res)
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return listener, conns, pongs
+}
+
+func TestClientCall(t *testing.T) {
+	listener, _, _ := startFakeServer(t)
+	defer listener.Close()
+
+	client, err := Dial(context.Background(), Config{Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pushed := make(chan string, 1)
+	client.Handle(1, 3, func(req *socketserver.SocketRequest) {
+		message, _ := req.GetString(0)
+		pushed <- message
+	})
+
+	res, err := client.Call(context.Background(), 1, 2, socketserver.ReqData{0: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message, _ := res.GetString(0); message != "hello" {
+		t.Fatalf("response not match. get %v", message)
+	}
+
+	select {
+	case message := <-pushed:
+		t.Log("push:", message)
+	case <-time.After(time.Second * 3):
+		t.Fatal("push not received")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	listener, conns, _ := startFakeServer(t)
+	defer listener.Close()
+
+	client, err := Dial(context.Background(), Config{
+		Address:          listener.Addr().String(),
+		Reconnect:        true,
+		ReconnectMinWait: time.Millisecond * 50,
+		ReconnectMaxWait: time.Millisecond * 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	reconnected := make(chan bool, 1)
+	client.OnConnect(func(*Client) error {
+		reconnected <- true
+		return nil
+	})
+
+	// 伺服器主動中斷第一條連線
+	(<-conns).Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second * 5):
+		t.Fatal("reconnect time out")
+	}
+
+	res, err := client.Call(context.Background(), 1, 1, socketserver.ReqData{0: "again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message, _ := res.GetString(0)
+	t.Log("response after reconnect:", message, "id:", res.GetID())
+}
+
+func TestClientPing(t *testing.T) {
+	listener, conns, pongs := startFakeServer(t)
+	defer listener.Close()
+
+	client, err := Dial(context.Background(), Config{Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 伺服器發出的心跳需以相同編號自動回覆
+	conn := <-conns
+	packer := socketserver.NewPacket(nil)
+	ping, _ := packer.PackFrame(socketserver.ReqID(7), time.Now(), socketserver.OpCodeSystem, socketserver.CmdPing, socketserver.ReqData{})
+	conn.Write(ping)
+
+	select {
+	case id := <-pongs:
+		if id != socketserver.ReqID(7) {
+			t.Fatalf("pong id mismatch. %v", id)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("pong not received")
+	}
+}
+
+// 回覆收到的資料並額外推送一筆資料的流程器
+type echoOperation struct {
+	socketserver.BaseOperation
+}
+
+func (op *echoOperation) GetOperationCode() socketserver.OperationCode { return 1 }
+func (op *echoOperation) Command(ctx context.Context, req *socketserver.SocketRequest) error {
+	data, _ := req.Get(0)
+	if err := req.Response(socketserver.ReqData{0: data}); err != nil {
+		return err
+	}
+
+	return req.Send(time.Now(), 1, 3, socketserver.ReqData{0: "push"})
+}
+
+// 啟動真正的伺服器，預設編碼為 json，監聽隨機埠
+func startServer(t *testing.T) *socketserver.SocketServer {
+	server, err := socketserver.NewServerWithSetting("test", logger.NewLogger("test", "local-test", logger.ERROR), nil, nil, &socketserver.AppSetting{
+		Server: socketserver.ServerSetting{
+			Name:         "Test Server",
+			Environment:  "test",
+			TimeOut:      30,
+			ReadBuffer:   1024,
+			ReadTimeOut:  5,
+			WriteBuffer:  1024,
+			WriteTimeOut: 5,
+			Codec:        "json",
+		},
+		Protocol: socketserver.ProtocolSetting{
+			ProtocolVersion:    1,
+			MinProtocolVersion: 1,
+		},
+		Operation: socketserver.OperationSetting{
+			RunMaxTime:  5,
+			MailboxSize: 64,
+			WorkerCount: 16,
+			QueueSize:   64,
+			QueueFull:   socketserver.QueueFullPause,
+		},
+		RateLimit: socketserver.RateLimitSetting{
+			Action: socketserver.RateLimitDrop,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.AddOperation(&echoOperation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	go server.Start()
+	return server
+}
+
+func TestClientHelloCodec(t *testing.T) {
+	server := startServer(t)
+	defer server.Shutdown(context.Background())
+
+	// 要求與伺服器預設不同的編碼，協商後改用 msgpack
+	client, err := Dial(context.Background(), Config{
+		Address: server.Addr().String(),
+		Codec:   "msgpack",
+		Hello:   &HelloInfo{ProtocolVersion: 1, ClientBuild: 1, Platform: "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pushed := make(chan string, 1)
+	client.Handle(1, 3, func(req *socketserver.SocketRequest) {
+		message, _ := req.GetString(0)
+		pushed <- message
+	})
+
+	res, err := client.Call(context.Background(), 1, 1, socketserver.ReqData{0: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// msgpack 解析出的整數與 json 的浮點數不同，可確認實際使用的編碼
+	if data, _ := res.Get(0); data != int64(42) {
+		t.Fatalf("echo mismatch. %v(%T)", data, data)
+	}
+
+	select {
+	case message := <-pushed:
+		if message != "push" {
+			t.Fatalf("push mismatch. %v", message)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("push not received")
+	}
+}
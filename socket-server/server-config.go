@@ -2,13 +2,23 @@ package socketserver
 
 type AppSetting struct {
 	Server    ServerSetting
+	KCP       KCPSetting
+	Protocol  ProtocolSetting
 	Operation OperationSetting
+	RateLimit RateLimitSetting
+	Auth      AuthSetting
+	Cluster   ClusterSetting
 }
 
 func (AppSetting) Name() string {
 	return "AppSetting"
 }
 
+// 設定值是否未填寫，config 會將空白或 "-" 轉為 "empty"
+func isSettingEmpty(value string) bool {
+	return value == "" || value == "empty"
+}
+
 type ServerSetting struct {
 	Name         string `default:"Socket Server"`
 	Environment  string `default:"dev"`
@@ -18,8 +28,96 @@ type ServerSetting struct {
 	ReadTimeOut  int    `default:"5"`
 	WriteBuffer  int    `default:"1024"`
 	WriteTimeOut int    `default:"5"`
+	Codec        string `default:"json"` // 請求資料編碼: json, msgpack, protobuf
+
+	WriteHighWater int `default:"4194304"` // 等待寫出的位元組上限，超過即視為接收過慢並中斷連線，0 為不限制
+	WriteCoalesce  int `default:"65536"`   // 單次寫出時合併封包的位元組上限
+
+	Compression       string `default:"snappy"`  // 封包壓縮: none, snappy, zstd
+	CompressThreshold int    `default:"1024"`    // 封包內容超過此大小才壓縮
+	MaxDecompressSize int    `default:"4194304"` // 解壓縮後的大小上限
+
+	MaxFrameSize       int `default:"1048576"` // 單一封包大小上限
+	MaxMalformedFrames int `default:"3"`       // 錯誤封包達此數量即中斷連線，0 為不限制
+
+	Encryption       string `default:"none"` // 封包加密: none, aes-gcm, chacha20-poly1305
+	HandshakeTimeOut int    `default:"5"`    // 金鑰交換超時秒數
+	HandshakeKeyFile string `default:"-"`    // 簽署金鑰交換的 Ed25519 私鑰 (PKCS#8 PEM)，未設定時無法防止中間人攻擊
+
+	WebSocketPort int    `default:"0"` // WebSocket 監聽埠，0 為不啟用
+	WebSocketPath string `default:"/ws"`
+
+	TLSMode           string `default:"off"` // off: 不加密, tls: 伺服器憑證, mtls: 雙向驗證
+	TLSCertFile       string `default:"-"`
+	TLSKeyFile        string `default:"-"`
+	TLSClientCAFile   string `default:"-"` // mtls 模式使用的客戶端憑證 CA
+	TLSReloadInterval int    `default:"0"` // 自動檢查憑證更新的間隔秒數，0 為不自動檢查
+
+	ShutdownTimeOut int    `default:"10"`             // 關閉時等待執行中流程的秒數
+	ShutdownMessage string `default:"Server closing"` // 關閉時通知客戶端的訊息，空白為不通知
+
+	ResumeGraceTime  int `default:"0"`   // 斷線後保留連線狀態的秒數，0 為不啟用斷線重連
+	ResumeMaxPending int `default:"256"` // 斷線期間暫存的封包數量上限，超過即放棄保留
+
+	PingInterval  int `default:"0"` // 心跳間隔秒數，0 為不啟用
+	PingMaxMissed int `default:"3"` // 連續未回覆心跳達此次數即中斷連線，0 為不限制
+}
+
+// 可靠UDP (KCP) 傳輸設定
+type KCPSetting struct {
+	Port         int  `default:"0"`  // KCP 監聽埠，0 為不啟用
+	NoDelay      int  `default:"1"`  // 1 為啟用 nodelay 模式
+	Interval     int  `default:"10"` // 內部更新間隔毫秒數
+	Resend       int  `default:"2"`  // 快速重傳觸發的 ACK 跨越次數，0 為不啟用
+	NoCongestion int  `default:"1"`  // 1 為關閉流量控制
+	SendWindow   int  `default:"128"`
+	RecvWindow   int  `default:"256"`
+	MTU          int  `default:"1350"`
+	DataShards   int  `default:"0"` // FEC 資料分片數，0 為不啟用
+	ParityShards int  `default:"0"` // FEC 校驗分片數
+	AckNoDelay   bool `default:"true"`
+	StreamMode   bool `default:"true"`
+}
+
+// 版本協商規則
+type ProtocolSetting struct {
+	ProtocolVersion    int    `default:"1"`     // 伺服器協定版本，較新的客戶端會被拒絕
+	MinProtocolVersion int    `default:"1"`     // 低於此協定版本需強制更新
+	MinClientBuild     int    `default:"0"`     // 低於此建置版本需強制更新
+	PlatformMinBuild   string `default:"-"`     // 各平台最低建置版本，例: ios:120,android:118
+	BlockedPlatforms   string `default:"-"`     // 拒絕連線的平台，以逗號分隔
+	UpgradeURL         string `default:"-"`     // 強制更新時回傳的網址
+	RequireHello       bool   `default:"false"` // 未完成版本協商前不處理其他請求
 }
 
 type OperationSetting struct {
-	RunMaxTime int `default:"5"`
+	RunMaxTime  int `default:"5"`  // 流程執行秒數上限，超時時取消流程的 ctx，流程需依 ctx 結束才會釋放工作者
+	MailboxSize int `default:"64"` // 每個客戶端等待執行的請求數量，已滿時暫停讀取
+
+	WorkerCount int    `default:"128"`   // 執行流程的工作數量，0 為不限制
+	QueueSize   int    `default:"1024"`  // 等待工作執行的請求數量上限
+	QueueFull   string `default:"pause"` // 佇列已滿時的處理方式: pause 暫停讀取, reject 回覆忙碌, disconnect 中斷連線
+}
+
+// 客戶端限流設定，流程與指令的限流規則由 SetOperationRateLimit、SetCommandRateLimit 設定
+type RateLimitSetting struct {
+	ClientRate  float64 `default:"0"`    // 每個客戶端每秒可送出的請求數，0 為不限制
+	ClientBurst int     `default:"0"`    // 瞬間可送出的請求數，0 時依每秒請求數計算
+	Action      string  `default:"drop"` // 超過限流時的處理方式: drop 丟棄, reject 回覆錯誤, kick 踢除客戶端
+}
+
+// 登入驗證設定
+type AuthSetting struct {
+	RequireLogin bool `default:"false"` // 未登入前只允許執行 SetPreAuthOperation 設定的流程
+	LoginTimeOut int  `default:"0"`     // 連線後需在此秒數內登入，否則中斷連線，0 為不限制
+}
+
+// 叢集設定
+type ClusterSetting struct {
+	NodeID      string `default:"-"`                   // 節點編號，未設定時啟動時自動產生
+	SingleLogin bool   `default:"false"`               // 同一玩家只允許一個連線，新登入會踢除舊連線
+	Redis       string `default:"-"`                   // 記錄玩家登入節點的 Redis 連線名稱，未設定時只檢查本節點
+	KeyPrefix   string `default:"login:"`              // 登入紀錄與踢除通知頻道的前綴
+	LoginTTL    int    `default:"300"`                 // 登入紀錄的存活秒數，節點定時延長，節點異常停止時紀錄自動過期，0 為不過期
+	KickMessage string `default:"Logged in elsewhere"` // 踢除舊連線時通知客戶端的訊息
 }
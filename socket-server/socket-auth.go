@@ -0,0 +1,100 @@
+package socketserver
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 設定流程可在登入前執行，例如登入、版本檢查等流程，需在伺服器啟動前設定
+func (server *SocketServer) SetPreAuthOperation(opCode OperationCode, preAuth bool) {
+	if preAuth {
+		server.preAuth[opCode] = true
+	} else {
+		delete(server.preAuth, opCode)
+	}
+}
+
+// 流程是否可在登入前執行
+func (server *SocketServer) isPreAuth(opCode OperationCode) bool {
+	return server.preAuth[opCode]
+}
+
+// 請求進入信箱前確認登入狀態，未登入時直接回覆錯誤，不佔用信箱與工作池
+//
+// 登入前流程尚未執行完時，登入結果未知，後續請求仍放行並排在登入之後，執行前由 checkAuth 再次確認
+func (client *SocketClient) allowBeforeLogin(req *SocketRequest) bool {
+	server := client.server
+	if !server.AppSetting.Auth.RequireLogin || client.IsAuthenticated() {
+		return true
+	}
+
+	if server.isPreAuth(req.OperationCode()) {
+		req.preAuth = true
+		atomic.AddInt32(&client.pendingPreAuth, 1)
+		return true
+	}
+
+	if atomic.LoadInt32(&client.pendingPreAuth) > 0 {
+		return true
+	}
+
+	client.logger.Warn(fmt.Sprintf("Client %v request before login. Op code = %v, Cmd code = %v", client.id, req.OperationCode(), req.CommandCode()))
+	req.ResponseError(ErrorCodeUnauthenticated, "unauthenticated")
+	return false
+}
+
+// 登入前流程執行完畢或被丟棄
+func (client *SocketClient) finishPreAuth(req *SocketRequest) {
+	if req.preAuth {
+		req.preAuth = false
+		atomic.AddInt32(&client.pendingPreAuth, -1)
+	}
+}
+
+// 確認請求可在客戶端目前的登入狀態下執行，未登入時回覆錯誤
+func (server *SocketServer) checkAuth(req *SocketRequest) bool {
+	if !server.AppSetting.Auth.RequireLogin || req.client == nil {
+		return true
+	}
+
+	if req.client.IsAuthenticated() || server.isPreAuth(req.OperationCode()) {
+		return true
+	}
+
+	server.logger.Warn(fmt.Sprintf("Client %v request before login. Op code = %v, Cmd code = %v", req.client.ID(), req.OperationCode(), req.CommandCode()))
+	req.ResponseError(ErrorCodeUnauthenticated, "unauthenticated")
+	return false
+}
+
+// 開始登入期限計時，期限內未登入即中斷連線
+func (client *SocketClient) startLoginTimer() {
+	login_time := time.Second * time.Duration(client.server.AppSetting.Auth.LoginTimeOut)
+	if login_time <= 0 {
+		return
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	if client.playerID != "" || client.connection == nil {
+		return
+	}
+
+	client.loginTimer = time.AfterFunc(login_time, func() {
+		if client.IsAuthenticated() {
+			return
+		}
+
+		client.logger.Warn(fmt.Sprintf("Client %v login time out", client.id))
+		client.Close(ErrLoginTimeOut)
+	})
+}
+
+// 停止登入期限計時，需在持有客戶端鎖時呼叫
+func (client *SocketClient) stopLoginTimer() {
+	if client.loginTimer != nil {
+		client.loginTimer.Stop()
+		client.loginTimer = nil
+	}
+}
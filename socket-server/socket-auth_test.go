@@ -0,0 +1,176 @@
+package socketserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 測試用登入流程器，以收到的玩家編號登入
+type loginOperation struct {
+	BaseOperation
+}
+
+func (op *loginOperation) GetOperationCode() OperationCode { return OperationCode(1) }
+func (op *loginOperation) Command(ctx context.Context, req *SocketRequest) error {
+	playerID, _ := req.GetString(DataCode(0))
+	if err := req.client.Login(playerID); err != nil {
+		return err
+	}
+
+	return req.Response(ReqData{DataCode(0): playerID})
+}
+
+func TestAuthGate(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Auth.RequireLogin = true
+	})
+	defer server.close()
+
+	server.AddOperation(&loginOperation{})
+	server.AddOperation(&echoOperation{opCode: OperationCode(2)})
+	server.SetPreAuthOperation(OperationCode(1), true)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 登入前的請求被拒絕，登入後才可執行
+	packer := NewPacket(nil)
+	frames := []struct {
+		opCode OperationCode
+		data   ReqData
+	}{
+		{OperationCode(2), ReqData{DataCode(0): "before"}},
+		{OperationCode(1), ReqData{DataCode(0): "player-1"}},
+		{OperationCode(2), ReqData{DataCode(0): "after"}},
+	}
+	for id, frame := range frames {
+		bd, _ := packer.PackFrame(ReqID(id+1), time.Now(), frame.opCode, CommandCode(1), frame.data)
+		conn.Write(bd)
+	}
+
+	res := readTestResponse(t, conn, packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdError {
+		t.Fatalf("request before login not rejected. Op code = %v", res.OperationCode())
+	}
+	if code, _ := res.GetInt64(DataCodeErrorCode); ErrorCode(code) != ErrorCodeUnauthenticated {
+		t.Fatalf("error code mismatch. %v", code)
+	}
+
+	if res = readTestResponse(t, conn, packer); res.OperationCode() != OperationCode(1) {
+		t.Fatalf("login response mismatch. Op code = %v", res.OperationCode())
+	}
+
+	res = readTestResponse(t, conn, packer)
+	if data, _ := res.GetString(DataCode(0)); res.OperationCode() != OperationCode(2) || data != "after" {
+		t.Fatalf("request after login mismatch. Op code = %v, data = %v", res.OperationCode(), data)
+	}
+
+	clients := waitTestClients(t, server, 1)
+	if !clients[0].IsAuthenticated() || clients[0].PlayerID() != "player-1" {
+		t.Fatal("client not authenticated")
+	}
+}
+
+func TestAuthLoginTimeOut(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Auth.LoginTimeOut = 1
+	})
+	defer server.close()
+
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := waitTestClients(t, server, 1)[0]
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := conn.Read(buffer); err != io.EOF {
+		t.Fatalf("connection not closed after login time out. %v", err)
+	}
+
+	if !errors.Is(client.DisconnectReason(), ErrLoginTimeOut) {
+		t.Fatalf("disconnect reason mismatch. %v", client.DisconnectReason())
+	}
+}
+
+func TestAuthRejectBeforeQueue(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Auth.RequireLogin = true
+		setting.Operation.WorkerCount = 1
+		setting.Operation.QueueSize = 1
+	})
+	defer server.close()
+
+	slow := &slowOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, delay: time.Second}
+	server.AddOperation(slow)
+	server.AddOperation(&echoOperation{opCode: OperationCode(3)})
+	server.SetPreAuthOperation(OperationCode(2), true)
+	server.listen()
+
+	busy, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitTestClients(t, server, 2)
+
+	// 佔住唯一的工作者，未登入的請求仍應立即被拒絕
+	packer := NewPacket(nil)
+	bd, _ := packer.PackFrame(1, time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): "slow"})
+	busy.Write(bd)
+	time.Sleep(time.Millisecond * 50)
+
+	startTime := time.Now()
+	bd, _ = packer.PackFrame(1, time.Now(), OperationCode(3), CommandCode(1), ReqData{})
+	conn.Write(bd)
+
+	res := readTestResponse(t, conn, packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdError {
+		t.Fatalf("request before login not rejected. Op code = %v", res.OperationCode())
+	}
+	if cost := time.Since(startTime); cost > time.Millisecond*500 {
+		t.Fatalf("request before login waited for worker. %v", cost)
+	}
+}
+
+func TestLoginEmptyPlayerID(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := waitTestClients(t, server, 1)[0]
+	if err := client.Login(""); !errors.Is(err, ErrPlayerIDEmpty) {
+		t.Fatalf("empty player id accepted. %v", err)
+	}
+
+	if client.IsAuthenticated() {
+		t.Fatal("client authenticated with empty player id")
+	}
+}
@@ -0,0 +1,137 @@
+package socketserver
+
+import (
+	"sync"
+	"time"
+)
+
+// 群發封包，依編碼器與壓縮設定暫存編碼結果，每種設定只編碼一次
+type broadcastFrame struct {
+	sync.Mutex
+
+	reqTime time.Time
+	opCode  OperationCode
+	cmdCode CommandCode
+	reqData ReqData
+	encoded map[frameEncodingKey][]byte
+}
+
+// 取得此封包以指定打包器編碼後的內容
+func (frame *broadcastFrame) encode(packer *Packer) ([]byte, error) {
+	encoding := packer.frameEncoding()
+	key := encoding.key()
+
+	frame.Lock()
+	defer frame.Unlock()
+
+	if plain, isExist := frame.encoded[key]; isExist {
+		return plain, nil
+	}
+
+	plain, err := encoding.encode(0, frame.reqTime, frame.opCode, frame.cmdCode, frame.reqData)
+	if err != nil {
+		return nil, err
+	}
+
+	frame.encoded[key] = plain
+	return plain, nil
+}
+
+// 發送封包給所有已連線的客戶端，回傳成功發送的客戶端數量與第一個發生的錯誤
+func (server *SocketServer) Broadcast(opCode OperationCode, cmdCode CommandCode, reqData ReqData) (int, error) {
+	return server.SendWhere(func(*SocketClient) bool { return true }, opCode, cmdCode, reqData)
+}
+
+// 發送封包給指定編號的客戶端，不存在的編號會略過
+func (server *SocketServer) SendTo(opCode OperationCode, cmdCode CommandCode, reqData ReqData, ids ...string) (int, error) {
+	targets := make([]*SocketClient, 0, len(ids))
+	for _, id := range ids {
+		if client, isExist := server.ClientRegistry.Get(id); isExist {
+			targets = append(targets, client)
+		}
+	}
+
+	return server.fanOut(targets, opCode, cmdCode, reqData)
+}
+
+// 發送封包給符合條件的客戶端
+func (server *SocketServer) SendWhere(predicate func(*SocketClient) bool, opCode OperationCode, cmdCode CommandCode, reqData ReqData) (int, error) {
+	clients := server.ClientRegistry.List()
+	targets := make([]*SocketClient, 0, len(clients))
+	for _, client := range clients {
+		if predicate(client) {
+			targets = append(targets, client)
+		}
+	}
+
+	return server.fanOut(targets, opCode, cmdCode, reqData)
+}
+
+// 同時發送給多個客戶端，單一客戶端寫入緩慢不會影響其他客戶端
+func (server *SocketServer) fanOut(targets []*SocketClient, opCode OperationCode, cmdCode CommandCode, reqData ReqData) (int, error) {
+	frame := &broadcastFrame{
+		reqTime: time.Now(),
+		opCode:  opCode,
+		cmdCode: cmdCode,
+		reqData: reqData,
+		encoded: make(map[frameEncodingKey][]byte),
+	}
+
+	var wait sync.WaitGroup
+	var lock sync.Mutex
+	var firstErr error
+	sent := 0
+
+	for _, client := range targets {
+		// 尚未發出連線事件的客戶端可能即將恢復為其他客戶端
+		if !client.isConnected() {
+			continue
+		}
+
+		wait.Add(1)
+		go func(client *SocketClient) {
+			defer wait.Done()
+
+			err := client.sendBroadcast(frame)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err == nil {
+				sent++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		}(client)
+	}
+
+	wait.Wait()
+	return sent, firstErr
+}
+
+// 發送群發封包，只需針對此客戶端加密
+func (client *SocketClient) sendBroadcast(frame *broadcastFrame) error {
+	select {
+	case <-client.ready:
+	case <-client.closed:
+		return ErrConnectionNull
+	}
+
+	client.Lock()
+	defer client.Unlock()
+
+	if client.detached {
+		return client.queueMissed(0, frame.reqTime, frame.opCode, frame.cmdCode, frame.reqData)
+	}
+
+	if client.connection == nil {
+		return ErrConnectionNull
+	}
+
+	plain, err := frame.encode(client.packer)
+	if err != nil {
+		return err
+	}
+
+	return client.writeBytes(client.packer.sealFrame(plain))
+}
@@ -0,0 +1,127 @@
+package socketserver
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcast(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.Encryption = EncryptionAESGCM
+		setting.Server.HandshakeTimeOut = 5
+	})
+	defer server.close()
+	server.listen()
+
+	type testConn struct {
+		conn   net.Conn
+		packer *Packer
+	}
+
+	conns := make([]testConn, 3)
+	for i := range conns {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		frameCipher, err := ClientHandshake(conn, nil, time.Second*5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packer := NewPacket(nil)
+		packer.SetCipher(frameCipher)
+		conns[i] = testConn{conn: conn, packer: packer}
+	}
+
+	clients := waitTestClients(t, server, len(conns))
+
+	sent, err := server.Broadcast(OperationCode(1), CommandCode(2), ReqData{DataCode(0): "all"})
+	if err != nil || sent != len(conns) {
+		t.Fatalf("broadcast fail. sent = %v, err = %v", sent, err)
+	}
+
+	for _, c := range conns {
+		res := readTestResponse(t, c.conn, c.packer)
+		if message, _ := res.GetString(DataCode(0)); message != "all" {
+			t.Fatalf("broadcast data mismatch. %v", message)
+		}
+	}
+
+	// 依照客戶端位址找出對應的測試連線
+	connOf := func(client *SocketClient) testConn {
+		for _, c := range conns {
+			if c.conn.LocalAddr().String() == client.RemoteAddr().String() {
+				return c
+			}
+		}
+
+		t.Fatalf("connection of %v not found", client.ID())
+		return testConn{}
+	}
+
+	sent, err = server.SendTo(OperationCode(1), CommandCode(3), ReqData{DataCode(0): "one"}, clients[0].ID(), "not-exist")
+	if err != nil || sent != 1 {
+		t.Fatalf("send to fail. sent = %v, err = %v", sent, err)
+	}
+
+	if res := readTestResponse(t, connOf(clients[0]).conn, connOf(clients[0]).packer); res.CommandCode() != CommandCode(3) {
+		t.Fatalf("send to data mismatch. %+v", res)
+	}
+
+	clients[1].Set(ClientInfoCode(0), "vip")
+	sent, err = server.SendWhere(func(client *SocketClient) bool {
+		return client.Get(ClientInfoCode(0)) == "vip"
+	}, OperationCode(1), CommandCode(4), ReqData{DataCode(0): "vip"})
+	if err != nil || sent != 1 {
+		t.Fatalf("send where fail. sent = %v, err = %v", sent, err)
+	}
+
+	if res := readTestResponse(t, connOf(clients[1]).conn, connOf(clients[1]).packer); res.CommandCode() != CommandCode(4) {
+		t.Fatalf("send where data mismatch. %+v", res)
+	}
+}
+
+func TestBroadcastFrameEncoding(t *testing.T) {
+	frame := &broadcastFrame{
+		reqTime: time.Now(),
+		opCode:  OperationCode(1),
+		cmdCode: CommandCode(1),
+		reqData: ReqData{DataCode(0): strings.Repeat("a", 1024)},
+		encoded: make(map[frameEncodingKey][]byte),
+	}
+
+	plainPacker := NewPacket(nil)
+	compressPacker := NewPacket(nil)
+	compressPacker.SetCompression(CompressionZstd, 64)
+	highPacker := NewPacket(nil)
+	highPacker.SetCompression(CompressionZstd, 1<<20)
+
+	// 編碼器相同但壓縮設定不同時不可共用編碼結果
+	for _, c := range []struct {
+		name       string
+		packer     *Packer
+		compressed bool
+	}{
+		{"plain", plainPacker, false},
+		{"zstd", compressPacker, true},
+		{"zstd over threshold", highPacker, false},
+	} {
+		plain, err := frame.encode(c.packer)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+
+		if compressed := plain[0] != 0; compressed != c.compressed {
+			t.Errorf("%v compress flag mismatch. flags = %v", c.name, plain[0])
+		}
+	}
+
+	if len(frame.encoded) != 3 {
+		t.Fatalf("encoded cache size mismatch. %v", len(frame.encoded))
+	}
+}
@@ -2,15 +2,18 @@ package socketserver
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"fmt"
 	"net"
 	"time"
 
 	"github.com/andy2kuo/AndyGameServerGo/logger"
+	"github.com/xtaci/kcp-go/v5"
 )
 
 type ClientEvent func(*SocketClient)
@@ -18,32 +21,298 @@ type ClientInfoCode byte
 
 var ErrConnectionNull error = errors.New("connection empty")
 var ErrClientHadLogin error = errors.New("client is login")
+var ErrPlayerIDEmpty error = errors.New("player id empty")
 
 // 客戶端
 type SocketClient struct {
 	sync.RWMutex
 
-	id              string       // 客戶端編號
-	connectTime     time.Time    // 連線時間
-	lastConnectTime time.Time    // 最後連線時間
-	connection      *net.TCPConn // 客戶端連接口
-	conn_ctx        context.Context
+	id              string          // 客戶端編號
+	connectTime     time.Time       // 連線時間
+	lastConnectTime time.Time       // 最後連線時間
+	connection      net.Conn        // 客戶端連接口
+	remoteAddr      net.Addr        // 客戶端遠端位址
+	conn_ctx        context.Context // 客戶端關閉或伺服器關閉時取消
+	conn_cancel     context.CancelFunc
 	logger          *logger.Logger
 	packer          *Packer
 	server          *SocketServer
+	closeOnce       sync.Once
+	closed          chan struct{} // 連線關閉通知
+	ready           chan struct{} // 金鑰交換完成通知
+
+	version   *ClientVersion // 版本協商結果
+	reqSerial uint32         // 伺服器發出請求的遞增編號
+
+	connectOnce sync.Once
+	connected   bool        // 是否已發出連線事件
+	connectDone bool        // 連線事件是否已執行完畢
+	pendingDrop bool        // 連線事件執行期間已關閉，斷線事件待連線事件結束後發出
+	closing     bool        // 已開始關閉，不再發出連線事件
+	playerID    string      // 登入的玩家編號
+	loginTimer  *time.Timer // 登入期限計時器
+	closeReason error       // 斷線原因
+
+	pendingPreAuth int32 // 已進入信箱但尚未執行完的登入前流程數量
+
+	resumeToken  string        // 恢復連線憑證，由 server.sessionLock 保護
+	detached     bool          // 連線中斷但仍在保留期間
+	detachReason error         // 進入保留期間的斷線原因
+	expired      bool          // 保留期間已結束，不可再恢復
+	resumeTimer  *time.Timer   // 保留期間計時器
+	missed       []missedFrame // 斷線期間未送出的封包
+
+	mailbox     chan *SocketRequest // 依序執行的請求
+	mailboxOnce sync.Once
+
+	limiter clientLimiter // 請求限流
+	outbox  *writeQueue   // 目前連線的寫出佇列
+
+	pingID     ReqID         // 等待回覆的心跳編號，0 為沒有等待中的心跳
+	pingTime   time.Time     // 心跳送出時間
+	pingMissed int           // 連續未回覆的心跳次數
+	srtt       time.Duration // 平滑後的來回延遲
+	rttvar     time.Duration // 來回延遲的抖動
 
 	customInfo map[ClientInfoCode]interface{}
 }
 
 // 開始客戶端進程
 func (client *SocketClient) StartProcess() {
-	client.connection.SetKeepAlive(true)
-	client.connection.SetKeepAlivePeriod(time.Second * time.Duration(client.server.AppSetting.Server.TimeOut))
-	client.connection.SetReadBuffer(client.server.AppSetting.Server.ReadBuffer)
-	client.connection.SetWriteBuffer(client.server.AppSetting.Server.WriteBuffer)
+	switch conn := client.connection.(type) {
+	case *net.TCPConn:
+		client.setupTCP(conn)
+	case *tls.Conn:
+		// TLS 連線仍需設定底層 TCP 連線
+		if tcpConn, isTCP := conn.NetConn().(*net.TCPConn); isTCP {
+			client.setupTCP(tcpConn)
+		}
+	case *kcp.UDPSession:
+		client.setupKCP(conn)
+	}
+
+	client.Lock()
+	client.startWriter(client.connection)
+	conn, packer := client.connection, client.packer
+	client.Unlock()
+
+	client.startLoginTimer()
+
+	// 接收封包
+	go func() {
+		// 金鑰交換完成前不可收發封包
+		if err := client.handshake(); err != nil {
+			client.logger.Warn(fmt.Sprintf("Client from %v handshake fail. %v", client.RemoteAddr().String(), err.Error()))
+			client.Close(err)
+			return
+		}
+
+		// 啟用斷線重連時，需等客戶端表明是否要恢復連線才發出連線事件
+		if !client.server.resumeEnabled() {
+			client.notifyConnect()
+		}
+
+		client.readLoop(conn, packer)
+	}()
+
+	go client.timeoutLoop(conn)
+	go client.heartbeatLoop(conn)
+}
+
+// 接收封包，連線被關閉或被替換時結束
+func (client *SocketClient) readLoop(conn net.Conn, packer *Packer) {
+	// 處理恢復連線前已收到的封包
+	if !client.processRequests(conn, packer) {
+		return
+	}
+
+	// 緩衝接收區
+	buffer := make([]byte, client.server.AppSetting.Server.ReadBuffer)
+	for {
+		time.Sleep(time.Millisecond)
+
+		select {
+		case <-client.conn_ctx.Done():
+			return
+		default:
+		}
+
+		nowTime := time.Now().UTC()
+		conn.SetReadDeadline(time.Now().Add(time.Second * time.Duration(client.server.AppSetting.Server.TimeOut)))
+		_getDataLength, readErr := conn.Read(buffer)
+		if client.currentConn() != conn {
+			return
+		}
+
+		if readErr == nil {
+			if _getDataLength > 0 {
+				client.touch(nowTime)
+				err := packer.Add(buffer[:_getDataLength])
+				if err != nil && client.onFrameError(packer, err) {
+					return
+				}
+			}
+		} else {
+			if errors.Is(readErr, io.EOF) {
+				client.disconnect(conn, ErrClientStop)
+				return
+			}
+
+			// 只有讀取逾時可以重試，連線重置或已關閉時以讀取錯誤為原因斷線
+			var netErr net.Error
+			if errors.As(readErr, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			client.logger.Warn(fmt.Sprintf("Socket read fail. %v", readErr.Error()))
+			client.disconnect(conn, readErr)
+			return
+		}
+
+		if !client.processRequests(conn, packer) {
+			return
+		}
+	}
+}
+
+// 處理已解析的請求，連線已轉移給其他客戶端時回傳 false
+func (client *SocketClient) processRequests(conn net.Conn, packer *Packer) bool {
+	for packer.Done() {
+		req := packer.GetWithClient(client)
+
+		// 系統流程 (版本協商、恢復連線、心跳) 同樣計入限流
+		if !client.allowRequest(req) {
+			// 被踢除時不再處理後續封包
+			if client.currentConn() != conn {
+				return false
+			}
+			continue
+		}
+
+		if req.OperationCode() == OpCodeSystem {
+			client.handleSystemRequest(req)
+			if client.currentConn() != conn {
+				return false
+			}
+			continue
+		}
+
+		if client.server.AppSetting.Protocol.RequireHello && !client.isHelloAccepted() {
+			client.logger.Warn(fmt.Sprintf("Client from %v request before hello. Op code = %v, Cmd code = %v", client.RemoteAddr().String(), req.OperationCode(), req.CommandCode()))
+			continue
+		}
+
+		if !client.allowBeforeLogin(req) {
+			continue
+		}
+
+		client.notifyConnect()
+		client.dispatch(req)
+	}
+
+	return true
+}
+
+// 檢查連線超時
+func (client *SocketClient) timeoutLoop(conn net.Conn) {
+	time_out := time.Second * time.Duration(client.server.AppSetting.Server.TimeOut)
+	for {
+		time.Sleep(time_out)
+
+		select {
+		case <-client.conn_ctx.Done():
+			return
+		default:
+			if client.currentConn() != conn {
+				return
+			}
+
+			if time.Now().UTC().Sub(client.lastActive()) > time_out {
+				client.logger.Warn(fmt.Sprintf("Client from %v time out", client.RemoteAddr().String()))
+				client.disconnect(conn, ErrConnectTimeOut)
+				return
+			}
+		}
+	}
+}
+
+// 取得目前的連線
+func (client *SocketClient) currentConn() net.Conn {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.connection
+}
+
+// 發出連線事件並發放恢復連線憑證，每個客戶端只會發出一次
+func (client *SocketClient) notifyConnect() {
+	client.connectOnce.Do(func() {
+		// 已關閉的客戶端不發出連線事件，與 Close 在同一個鎖內判斷才不會只有連線沒有斷線
+		client.Lock()
+		if client.closing {
+			client.Unlock()
+			return
+		}
+		client.connected = true
+		client.Unlock()
+
+		client.server.OnClientConnect(client)
+
+		client.Lock()
+		client.connectDone = true
+		pendingDrop := client.pendingDrop
+		client.Unlock()
+
+		// 連線事件執行期間已關閉，由此補發斷線事件
+		if pendingDrop {
+			client.server.OnClientDisconnect(client)
+			return
+		}
+
+		if client.server.resumeEnabled() {
+			token := client.server.issueResumeToken(client)
+			err := client.Send(time.Now(), OpCodeSystem, CmdResumeToken, ReqData{DataCodeResumeToken: token})
+			if err != nil {
+				client.logger.Warn(fmt.Sprintf("Client resume token send fail. %v", err.Error()))
+			}
+		}
+	})
+}
+
+// 是否已發出連線事件
+// 關閉時是否需要發出斷線事件，連線事件尚未執行完時改由連線事件結束後發出
+func (client *SocketClient) takeDisconnect() bool {
+	client.Lock()
+	defer client.Unlock()
+
+	if !client.connected {
+		return false
+	}
+
+	if !client.connectDone {
+		client.pendingDrop = true
+		return false
+	}
+
+	return true
+}
+
+func (client *SocketClient) isConnected() bool {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.connected
+}
+
+// 設定TCP連線參數
+func (client *SocketClient) setupTCP(tcpConn *net.TCPConn) {
+	tcpConn.SetKeepAlive(true)
+	tcpConn.SetKeepAlivePeriod(time.Second * time.Duration(client.server.AppSetting.Server.TimeOut))
+	tcpConn.SetReadBuffer(client.server.AppSetting.Server.ReadBuffer)
+	tcpConn.SetWriteBuffer(client.server.AppSetting.Server.WriteBuffer)
 
 	// Getting the file handle of the socket
-	sockFile, sockErr := client.connection.File()
+	sockFile, sockErr := tcpConn.File()
 	if sockErr == nil {
 		//var err error
 		//// got socket file handle. Getting descriptor.
@@ -63,112 +332,279 @@ func (client *SocketClient) StartProcess() {
 	} else {
 		client.logger.Warn("on setting socket keepalive", sockErr.Error())
 	}
+}
 
-	// 接收封包
-	go func() {
-		// 緩衝接收區
-		buffer := make([]byte, client.server.AppSetting.Server.ReadBuffer)
-	Loop:
-		for client.connection != nil {
-			time.Sleep(time.Millisecond)
-
-			select {
-			case <-client.conn_ctx.Done():
-				break Loop
-			default:
-				nowTime := time.Now().UTC()
-				client.connection.SetReadDeadline(time.Now().Add(time.Second * time.Duration(client.server.AppSetting.Server.TimeOut)))
-				_getDataLength, readErr := client.connection.Read(buffer)
-				if readErr == nil {
-					if _getDataLength > 0 {
-						client.lastConnectTime = nowTime
-						err := client.packer.Add(buffer[:_getDataLength])
-						if err != nil {
-							client.logger.Error(fmt.Sprintf("Socket add buffer fail. %v", err.Error()))
-						}
-					}
-				} else {
-					if errors.Is(readErr, io.EOF) {
-						client.Close(ErrClientStop)
-						break Loop
-					}
-
-					client.logger.Error(fmt.Sprintf("Socket read fail. %v", readErr.Error()))
-					continue
-				}
+// 處理封包解析錯誤，回傳是否已中斷連線
+func (client *SocketClient) onFrameError(packer *Packer, err error) bool {
+	count := packer.MalformedCount()
+	maxCount := client.server.AppSetting.Server.MaxMalformedFrames
 
-				for client.packer.Done() {
-					req := client.packer.GetWithClient(client)
-					go client.server.RunOperation(req)
-				}
-			}
-		}
-	}()
+	var frameErr *FrameError
+	if !errors.As(err, &frameErr) {
+		client.logger.Error(fmt.Sprintf("Socket add buffer fail. %v", err.Error()))
+		return false
+	}
 
-	go func() {
-		time_out := time.Second * time.Duration(client.server.AppSetting.Server.TimeOut)
-	Loop:
-		for {
-			time.Sleep(time_out)
-
-			select {
-			case <-client.conn_ctx.Done():
-				break Loop
-			default:
-				if client.connection != nil {
-					if time.Now().UTC().Sub(client.lastConnectTime) > time_out {
-						client.logger.Warn(fmt.Sprintf("Client from %v time out", client.connection.RemoteAddr().String()))
-						client.Close(ErrConnectTimeOut)
-						break Loop
-					}
-				} else {
-					break Loop
-				}
-			}
-		}
-	}()
+	client.logger.Warn(fmt.Sprintf("Malformed frame. client = %v, remote = %v, reason = %v, length = %v, fatal = %v, count = %v/%v, error = %v",
+		client.id, client.RemoteAddr().String(), frameErr.Reason, frameErr.Length, frameErr.Fatal, count, maxCount, frameErr.Err))
+
+	switch {
+	case errors.Is(err, ErrFrameAuthFail):
+		client.Close(ErrFrameAuthFail)
+	case frameErr.Fatal:
+		client.Close(frameErr)
+	case maxCount > 0 && count >= maxCount:
+		client.Close(ErrTooManyMalformedFrames)
+	default:
+		return false
+	}
+
+	return true
 }
 
-// 關閉客戶端連線
+// 進行金鑰交換，未啟用加密時直接完成
+func (client *SocketClient) handshake() error {
+	defer close(client.ready)
+
+	encryption := client.server.AppSetting.Server.Encryption
+	if id, _ := encryptionID(encryption); id == 0 {
+		return nil
+	}
+
+	frameCipher, err := ServerHandshake(client.connection, encryption, client.server.handshakeKey, time.Second*time.Duration(client.server.AppSetting.Server.HandshakeTimeOut))
+	if err != nil {
+		return err
+	}
+
+	client.packer.SetCipher(frameCipher)
+	return nil
+}
+
+// 取得客戶端編號
+func (client *SocketClient) ID() string {
+	return client.id
+}
+
+// 取得客戶端遠端位址
+func (client *SocketClient) RemoteAddr() net.Addr {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.remoteAddr
+}
+
+// 記錄收到資料的時間，恢復連線時會與 attach 同時寫入
+func (client *SocketClient) touch(nowTime time.Time) {
+	client.Lock()
+	defer client.Unlock()
+
+	client.lastConnectTime = nowTime
+}
+
+// 取得最後收到資料的時間
+func (client *SocketClient) lastActive() time.Time {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.lastConnectTime
+}
+
+// 關閉客戶端連線，不保留連線狀態，多次呼叫時只有第一次的原因有效
 func (client *SocketClient) Close(err error) {
-	defer func() {
-		if client.connection != nil {
-			client.connection.Close()
-			client.connection = nil
+	isFirst := false
+	client.closeOnce.Do(func() {
+		isFirst = true
+
+		client.Lock()
+		conn, outbox := client.connection, client.outbox
+		client.closing = true
+		client.connection = nil
+		client.outbox = nil
+		client.closeReason = err
+		client.detached = false
+		client.missed = nil
+		if client.resumeTimer != nil {
+			client.resumeTimer.Stop()
+			client.resumeTimer = nil
+		}
+		client.stopLoginTimer()
+		client.Unlock()
+
+		// 先寫出佇列中的封包，踢除與關閉通知才能送達
+		if outbox != nil {
+			client.flushWriter(outbox)
+		}
+
+		if conn != nil {
+			conn.Close()
 			client.logger.Info("Client Close. Reason:", err.Error())
 		}
-	}()
+
+		close(client.closed)
+		client.conn_cancel()
+	})
+
+	// 事件需在 closeOnce 之外發出，流程器在事件中再次呼叫 Close 才不會卡住
+	if isFirst {
+		client.server.onClientClosed(client)
+	}
 }
 
-// 發送封包
+// 通知客戶端被踢除後關閉連線
+func (client *SocketClient) Kick(message string) {
+	err := client.Send(time.Now(), OpCodeSystem, CmdKick, ReqData{DataCodeMessage: message})
+	if err != nil {
+		client.logger.Warn(fmt.Sprintf("Client %v kick notify fail. %v", client.id, err.Error()))
+	}
+
+	client.Close(fmt.Errorf("%w: %v", ErrClientKicked, message))
+}
+
+// 取得客戶端的 context，客戶端關閉或伺服器關閉時取消
+func (client *SocketClient) Context() context.Context {
+	return client.conn_ctx
+}
+
+// 取得斷線原因，尚未斷線時回傳 nil
+func (client *SocketClient) DisconnectReason() error {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.closeReason
+}
+
+// 登入，標記客戶端已通過驗證並發出驗證事件
+func (client *SocketClient) Login(playerID string) error {
+	if playerID == "" {
+		return ErrPlayerIDEmpty
+	}
+
+	client.Lock()
+	if client.playerID != "" {
+		client.Unlock()
+		return ErrClientHadLogin
+	}
+	client.playerID = playerID
+	client.stopLoginTimer()
+	client.Unlock()
+
+	// 單一登入時踢除此玩家的舊連線
+	client.server.claimLogin(client)
+	client.server.OnClientAuthenticated(client)
+	return nil
+}
+
+// 取得登入的玩家編號，尚未登入時為空字串
+func (client *SocketClient) PlayerID() string {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.playerID
+}
+
+// 是否已登入
+func (client *SocketClient) IsAuthenticated() bool {
+	return client.PlayerID() != ""
+}
+
+// 設定此客戶端使用的請求資料編碼器，用於與客戶端協商編碼
+func (client *SocketClient) SetCodec(name string) error {
+	codec, err := GetCodec(name)
+	if err != nil {
+		return err
+	}
+
+	client.RLock()
+	defer client.RUnlock()
+
+	client.packer.SetCodec(codec)
+	return nil
+}
+
+// 取得此客戶端使用的請求資料編碼器名稱
+func (client *SocketClient) CodecName() string {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.packer.Codec().Name()
+}
+
+// 客戶端連線關閉通知
+func (client *SocketClient) Closed() <-chan struct{} {
+	return client.closed
+}
+
+// 發送封包，請求編號為 0
 func (client *SocketClient) Send(reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) error {
+	return client.send(0, reqTime, opCode, cmdCode, reqData)
+}
+
+// 以新的請求編號發送請求，回傳的編號可用於對應客戶端的回覆
+func (client *SocketClient) SendRequest(opCode OperationCode, cmdCode CommandCode, reqData ReqData) (ReqID, error) {
+	reqID := client.NextRequestID()
+	return reqID, client.send(reqID, time.Now(), opCode, cmdCode, reqData)
+}
+
+// 產生此連線的下一個請求編號，跳過 0
+func (client *SocketClient) NextRequestID() ReqID {
+	for {
+		if id := ReqID(atomic.AddUint32(&client.reqSerial, 1)); id != 0 {
+			return id
+		}
+	}
+}
+
+// 發送封包
+func (client *SocketClient) send(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) error {
+	// 等待金鑰交換完成
+	select {
+	case <-client.ready:
+	case <-client.closed:
+		return ErrConnectionNull
+	}
+
 	client.Lock()
 	defer client.Unlock()
 
-	byteData, err := client.packer.PackData(reqTime, opCode, cmdCode, reqData)
+	// 斷線保留期間先暫存，恢復連線後補發
+	if client.detached {
+		return client.queueMissed(reqID, reqTime, opCode, cmdCode, reqData)
+	}
+
+	return client.write(reqID, reqTime, opCode, cmdCode, reqData)
+}
+
+// 打包並放入寫出佇列，加密的 nonce 順序需與寫出順序一致，呼叫前必須持有鎖
+func (client *SocketClient) write(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) error {
+	byteData, err := client.packer.PackFrame(reqID, reqTime, opCode, cmdCode, reqData)
 
 	if err != nil {
 		return err
 	}
 
-	if client.connection != nil {
-		client.connection.SetWriteDeadline(time.Now().Add(time.Second * time.Duration(client.server.AppSetting.Server.WriteTimeOut)))
-		_, err := client.connection.Write(byteData)
-		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				client.logger.Error(fmt.Sprintf("Client send data fail, error => %v", err.Error()))
-				return err
-			} else {
-				client.logger.Error("Client send data fail, connection error => EOF")
-				return err
-			}
-		}
+	return client.writeBytes(byteData)
+}
 
-		return nil
-	} else {
+// 將已打包的封包放入寫出佇列，等待寫出的資料超過上限時中斷連線，呼叫前必須持有鎖
+func (client *SocketClient) writeBytes(byteData []byte) error {
+	if client.connection == nil || client.outbox == nil {
 		client.logger.Error("Client send data fail, connection error => Empty")
 		return ErrConnectionNull
 	}
+
+	pending, isOpen := client.outbox.push(byteData)
+	if !isOpen {
+		return ErrConnectionNull
+	}
+
+	if high_water := client.server.AppSetting.Server.WriteHighWater; high_water > 0 && pending > high_water {
+		client.logger.Warn(fmt.Sprintf("Client %v write queue over high water mark. pending = %v bytes", client.id, pending))
+		client.outbox.close(true)
+		go client.Close(ErrSlowConsumer)
+		return ErrSlowConsumer
+	}
+
+	return nil
 }
 
 // 設定自訂資料
@@ -177,6 +613,7 @@ func (client *SocketClient) Set(code ClientInfoCode, data interface{}) {
 	defer client.Unlock()
 
 	client.customInfo[code] = data
+	client.server.ClientRegistry.setIndex(client, code, data)
 }
 
 // 取得自訂資料
@@ -202,6 +639,7 @@ func (client *SocketClient) Clear(code ClientInfoCode) {
 
 	if isExist {
 		delete(client.customInfo, code)
+		client.server.ClientRegistry.setIndex(client, code, nil)
 	}
 }
 
@@ -210,22 +648,34 @@ func (client *SocketClient) ClearAll() {
 	client.Lock()
 	defer client.Unlock()
 
+	for code := range client.customInfo {
+		client.server.ClientRegistry.setIndex(client, code, nil)
+	}
+
 	client.customInfo = make(map[ClientInfoCode]interface{})
 }
 
 // 產生新的客戶端
-func NewClient(id string, server *SocketServer, ctx context.Context, conn *net.TCPConn) *SocketClient {
+func NewClient(id string, server *SocketServer, ctx context.Context, conn net.Conn) *SocketClient {
 	new_client := &SocketClient{
 		id:              id,
 		connectTime:     time.Now().UTC(),
 		lastConnectTime: time.Now().UTC(),
 		connection:      conn,
-		conn_ctx:        ctx,
+		remoteAddr:      conn.RemoteAddr(),
 		server:          server,
 		logger:          server.logger,
 		customInfo:      make(map[ClientInfoCode]interface{}),
+		closed:          make(chan struct{}),
+		ready:           make(chan struct{}),
+		mailbox:         make(chan *SocketRequest, server.AppSetting.Operation.MailboxSize),
+		limiter: clientLimiter{
+			operation: make(map[OperationCode]*tokenBucket),
+			command:   make(map[commandKey]*tokenBucket),
+		},
 	}
 
+	new_client.conn_ctx, new_client.conn_cancel = context.WithCancel(ctx)
 	new_client.packer = NewPacket(new_client)
 
 	return new_client
@@ -0,0 +1,240 @@
+package socketserver
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 記錄各客戶端事件次數與斷線原因的流程器
+type hookOperation struct {
+	echoOperation
+	sync.Mutex
+
+	events  map[*SocketClient][]string
+	reasons map[*SocketClient]error
+}
+
+func (op *hookOperation) record(client *SocketClient, event string) error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.events[client] = append(op.events[client], event)
+	return nil
+}
+
+func (op *hookOperation) OnClientConnect(client *SocketClient) error {
+	return op.record(client, "connect")
+}
+
+func (op *hookOperation) OnClientAuthenticated(client *SocketClient) error {
+	return op.record(client, "authenticated")
+}
+
+func (op *hookOperation) OnClientDisconnect(client *SocketClient) error {
+	op.Lock()
+	op.reasons[client] = client.DisconnectReason()
+	op.Unlock()
+
+	return op.record(client, "disconnect")
+}
+
+func (op *hookOperation) eventsOf(client *SocketClient) []string {
+	op.Lock()
+	defer op.Unlock()
+
+	return append([]string{}, op.events[client]...)
+}
+
+func TestClientLifecycle(t *testing.T) {
+	server := newTestServer(t)
+
+	op := &hookOperation{
+		echoOperation: echoOperation{opCode: OperationCode(2)},
+		events:        make(map[*SocketClient][]string),
+		reasons:       make(map[*SocketClient]error),
+	}
+	server.AddOperation(op)
+	server.listen()
+
+	conns := make(map[string]net.Conn)
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[conn.LocalAddr().String()] = conn
+	}
+
+	clients := waitTestClients(t, server, len(conns))
+	kicked, closedByPeer, remain := clients[0], clients[1], clients[2]
+
+	if err := kicked.Login("player-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := kicked.Login("player-2"); !errors.Is(err, ErrClientHadLogin) {
+		t.Fatalf("login twice should fail. %v", err)
+	}
+	if kicked.PlayerID() != "player-1" || !kicked.IsAuthenticated() {
+		t.Fatalf("player id mismatch. %v", kicked.PlayerID())
+	}
+
+	// 多個協程同時關閉，事件只發出一次
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			kicked.Kick("logged in elsewhere")
+		}()
+	}
+	wait.Wait()
+
+	conn := conns[kicked.RemoteAddr().String()]
+	res := readTestResponse(t, conn, NewPacket(nil))
+	if message, _ := res.GetString(DataCodeMessage); res.CommandCode() != CmdKick || message != "logged in elsewhere" {
+		t.Fatalf("kick notify mismatch. %+v", res)
+	}
+
+	conns[closedByPeer.RemoteAddr().String()].Close()
+	<-closedByPeer.Closed()
+
+	server.close()
+	<-remain.Closed()
+
+	cases := []struct {
+		client *SocketClient
+		events []string
+		reason error
+	}{
+		{kicked, []string{"connect", "authenticated", "disconnect"}, ErrClientKicked},
+		{closedByPeer, []string{"connect", "disconnect"}, ErrClientStop},
+		{remain, []string{"connect", "disconnect"}, ErrServerShutdown},
+	}
+
+	for _, c := range cases {
+		// 斷線事件在關閉通知之後才發出
+		events := op.eventsOf(c.client)
+		for retry := 0; len(events) < len(c.events) && retry < 100; retry++ {
+			time.Sleep(time.Millisecond * 10)
+			events = op.eventsOf(c.client)
+		}
+
+		if len(events) != len(c.events) {
+			t.Fatalf("events mismatch. expect %v, get %v", c.events, events)
+		}
+		for i := range events {
+			if events[i] != c.events[i] {
+				t.Fatalf("events mismatch. expect %v, get %v", c.events, events)
+			}
+		}
+
+		op.Lock()
+		reason := op.reasons[c.client]
+		op.Unlock()
+		if !errors.Is(reason, c.reason) {
+			t.Errorf("disconnect reason mismatch. expect %v, get %v", c.reason, reason)
+		}
+	}
+}
+
+// 連線事件執行較久的流程器，用於測試事件期間關閉客戶端
+type slowConnectOperation struct {
+	hookOperation
+}
+
+func (op *slowConnectOperation) OnClientConnect(client *SocketClient) error {
+	op.record(client, "connect")
+	client.Close(ErrClientStop)
+	time.Sleep(time.Millisecond * 100)
+	return op.record(client, "connect-end")
+}
+
+func TestClientCloseDuringConnect(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	op := &slowConnectOperation{hookOperation{
+		echoOperation: echoOperation{opCode: OperationCode(2)},
+		events:        make(map[*SocketClient][]string),
+		reasons:       make(map[*SocketClient]error),
+	}}
+	server.AddOperation(op)
+
+	// 連線事件期間關閉，斷線事件需在連線事件結束後才發出
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	client := NewClient("during", server, server.ctx, conn)
+	client.notifyConnect()
+
+	events := op.eventsOf(client)
+	if len(events) != 3 || events[0] != "connect" || events[1] != "connect-end" || events[2] != "disconnect" {
+		t.Fatalf("events mismatch. %v", events)
+	}
+
+	// 已關閉的客戶端不再發出連線事件
+	closedConn, closedPeer := net.Pipe()
+	defer closedPeer.Close()
+
+	closed := NewClient("closed", server, server.ctx, closedConn)
+	closed.Close(ErrClientStop)
+	closed.notifyConnect()
+
+	if events := op.eventsOf(closed); len(events) != 0 {
+		t.Fatalf("closed client fire events. %v", events)
+	}
+}
+
+// 讀取時回傳指定錯誤的連線
+type errorReadConn struct {
+	net.Conn
+	err error
+}
+
+func (conn errorReadConn) Read([]byte) (int, error) {
+	time.Sleep(time.Millisecond * 10)
+	return 0, conn.err
+}
+
+func TestClientReadError(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	// 讀取逾時只重試，不中斷連線
+	timeoutConn, timeoutPeer := net.Pipe()
+	defer timeoutPeer.Close()
+
+	waiting := NewClient("timeout", server, server.ctx, errorReadConn{timeoutConn, os.ErrDeadlineExceeded})
+	waiting.StartProcess()
+	defer waiting.Close(ErrClientStop)
+
+	select {
+	case <-waiting.Closed():
+		t.Fatalf("client closed on read timeout. %v", waiting.DisconnectReason())
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	// 連線重置時立即以讀取錯誤斷線
+	resetConn, resetPeer := net.Pipe()
+	defer resetPeer.Close()
+
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	reset := NewClient("reset", server, server.ctx, errorReadConn{resetConn, resetErr})
+	reset.StartProcess()
+
+	select {
+	case <-reset.Closed():
+	case <-time.After(time.Second * 3):
+		t.Fatal("client not closed after connection reset")
+	}
+
+	if !errors.Is(reset.DisconnectReason(), syscall.ECONNRESET) {
+		t.Fatalf("disconnect reason mismatch. %v", reset.DisconnectReason())
+	}
+}
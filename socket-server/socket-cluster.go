@@ -0,0 +1,247 @@
+package socketserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis 操作的時間上限
+const clusterRedisTimeOut = time.Second * 3
+
+// 只在登入紀錄仍屬於此連線時才延長存活時間
+var refreshLoginScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("EXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// 只在登入紀錄仍屬於此連線時才刪除
+var releaseLoginScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// 取得此節點的編號
+func (server *SocketServer) NodeID() string {
+	return server.nodeID
+}
+
+// 初始化叢集設定，指定 Redis 連線時訂閱此節點的踢除通知
+func (server *SocketServer) setupCluster() error {
+	setting := server.AppSetting.Cluster
+
+	server.nodeID = setting.NodeID
+	if server.nodeID == "" || server.nodeID == "empty" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		server.nodeID = hex.EncodeToString(id)
+	}
+
+	if !setting.SingleLogin || setting.Redis == "" || setting.Redis == "empty" {
+		return nil
+	}
+
+	if server.redisConn == nil {
+		return ErrClusterRedisNotSet
+	}
+
+	cli, err := server.redisConn.GetRedis(setting.Redis)
+	if err != nil {
+		return err
+	}
+
+	server.clusterRedis = cli
+	pubsub := cli.Subscribe(server.ctx, server.kickChannel(server.nodeID))
+
+	// 確認訂閱成功後才開始接收
+	if _, err := pubsub.Receive(server.ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go server.receiveKick(pubsub)
+	go server.refreshLogins()
+	return nil
+}
+
+// 登入紀錄的存活時間，0 為不過期
+func (server *SocketServer) loginTTL() time.Duration {
+	return time.Second * time.Duration(server.AppSetting.Cluster.LoginTTL)
+}
+
+// 定時延長本節點玩家的登入紀錄，每個存活時間內延長三次，避免單次失敗就過期
+func (server *SocketServer) refreshLogins() {
+	ttl := server.loginTTL()
+	if ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-server.ctx.Done():
+			return
+		}
+
+		server.loginLock.Lock()
+		sessions := make(map[string]string, len(server.logins))
+		for playerID, client := range server.logins {
+			sessions[playerID] = server.nodeID + "|" + client.ID()
+		}
+		server.loginLock.Unlock()
+
+		if len(sessions) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(server.ctx, clusterRedisTimeOut)
+		_, err := server.clusterRedis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for playerID, session := range sessions {
+				refreshLoginScript.Eval(ctx, pipe, []string{server.loginKey(playerID)}, session, int64(ttl/time.Second))
+			}
+			return nil
+		})
+		cancel()
+
+		if err != nil && err != redis.Nil {
+			server.logger.Error(fmt.Sprintf("Cluster login refresh fail. count = %v, error message => %v", len(sessions), err.Error()))
+		}
+	}
+}
+
+// 節點的踢除通知頻道
+func (server *SocketServer) kickChannel(nodeID string) string {
+	return fmt.Sprintf("%vkick:%v", server.AppSetting.Cluster.KeyPrefix, nodeID)
+}
+
+// 玩家登入紀錄的鍵值
+func (server *SocketServer) loginKey(playerID string) string {
+	return server.AppSetting.Cluster.KeyPrefix + playerID
+}
+
+// 接收其他節點送來的踢除通知，內容為 "玩家編號|客戶端編號"
+func (server *SocketServer) receiveKick(pubsub *redis.PubSub) {
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, isOpen := <-ch:
+			if !isOpen {
+				return
+			}
+
+			pair := strings.SplitN(msg.Payload, "|", 2)
+			if len(pair) != 2 {
+				server.logger.Warn(fmt.Sprintf("Cluster kick message malformed. %v", msg.Payload))
+				continue
+			}
+
+			client, isExist := server.ClientRegistry.Get(pair[1])
+			if !isExist || client.PlayerID() != pair[0] {
+				continue
+			}
+
+			server.logger.Info(fmt.Sprintf("Client %v kicked by cluster. Player = %v", client.ID(), pair[0]))
+			client.Kick(server.AppSetting.Cluster.KickMessage)
+		case <-server.ctx.Done():
+			return
+		}
+	}
+}
+
+// 登入時記錄玩家所在的連線，並踢除此玩家在本節點或其他節點的舊連線
+func (server *SocketServer) claimLogin(client *SocketClient) {
+	if !server.AppSetting.Cluster.SingleLogin {
+		return
+	}
+
+	playerID := client.PlayerID()
+
+	server.loginLock.Lock()
+	old_client := server.logins[playerID]
+	server.logins[playerID] = client
+	server.loginLock.Unlock()
+
+	if old_client != nil && old_client != client {
+		server.logger.Info(fmt.Sprintf("Player %v logged in again, kick client %v", playerID, old_client.ID()))
+		old_client.Kick(server.AppSetting.Cluster.KickMessage)
+	}
+
+	if server.clusterRedis == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(server.ctx, clusterRedisTimeOut)
+	defer cancel()
+
+	// 寫入時一併設定存活時間，節點異常停止時紀錄不會永久殘留
+	session := server.nodeID + "|" + client.ID()
+	var getSet *redis.StringCmd
+	_, err := server.clusterRedis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		getSet = pipe.GetSet(ctx, server.loginKey(playerID), session)
+		if ttl := server.loginTTL(); ttl > 0 {
+			pipe.Expire(ctx, server.loginKey(playerID), ttl)
+		}
+		return nil
+	})
+
+	old_session, _ := getSet.Result()
+	if err != nil && err != redis.Nil {
+		server.logger.Error(fmt.Sprintf("Cluster login record fail. Player = %v, error message => %v", playerID, err.Error()))
+		return
+	}
+
+	// 舊連線在本節點時已在上方處理
+	pair := strings.SplitN(old_session, "|", 2)
+	if len(pair) != 2 || pair[0] == server.nodeID {
+		return
+	}
+
+	err = server.clusterRedis.Publish(ctx, server.kickChannel(pair[0]), playerID+"|"+pair[1]).Err()
+	if err != nil {
+		server.logger.Error(fmt.Sprintf("Cluster kick notify fail. Player = %v, Node = %v, error message => %v", playerID, pair[0], err.Error()))
+	}
+}
+
+// 客戶端關閉時移除登入紀錄，紀錄已屬於新連線時保留
+func (server *SocketServer) releaseLogin(client *SocketClient) {
+	playerID := client.PlayerID()
+	if !server.AppSetting.Cluster.SingleLogin || playerID == "" {
+		return
+	}
+
+	server.loginLock.Lock()
+	if server.logins[playerID] == client {
+		delete(server.logins, playerID)
+	}
+	server.loginLock.Unlock()
+
+	if server.clusterRedis == nil {
+		return
+	}
+
+	// 伺服器關閉時 server.ctx 已取消，改用獨立的期限
+	ctx, cancel := context.WithTimeout(context.Background(), clusterRedisTimeOut)
+	defer cancel()
+
+	session := server.nodeID + "|" + client.ID()
+	err := releaseLoginScript.Run(ctx, server.clusterRedis, []string{server.loginKey(playerID)}, session).Err()
+	if err != nil && err != redis.Nil {
+		server.logger.Error(fmt.Sprintf("Cluster login release fail. Player = %v, error message => %v", playerID, err.Error()))
+	}
+}
@@ -0,0 +1,177 @@
+package socketserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/andy2kuo/AndyGameServerGo/database"
+)
+
+// 以指定玩家編號登入，回傳連線
+func loginTestClient(t *testing.T, server *SocketServer, playerID string) (net.Conn, *Packer) {
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packer := NewPacket(nil)
+	bd, _ := packer.PackFrame(ReqID(1), time.Now(), OperationCode(1), CommandCode(1), ReqData{DataCode(0): playerID})
+	conn.Write(bd)
+
+	if res := readTestResponse(t, conn, packer); res.OperationCode() != OperationCode(1) {
+		t.Fatalf("login response mismatch. Op code = %v", res.OperationCode())
+	}
+
+	return conn, packer
+}
+
+func TestSingleLogin(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Cluster.SingleLogin = true
+		setting.Cluster.KickMessage = "Logged in elsewhere"
+	})
+	defer server.close()
+
+	server.AddOperation(&loginOperation{})
+	server.listen()
+
+	old_conn, old_packer := loginTestClient(t, server, "player-1")
+	defer old_conn.Close()
+	old_client := waitTestClients(t, server, 1)[0]
+
+	new_conn, _ := loginTestClient(t, server, "player-1")
+	defer new_conn.Close()
+
+	// 舊連線收到踢除通知後被關閉
+	res := readTestResponse(t, old_conn, old_packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdKick {
+		t.Fatalf("kick notify mismatch. Op code = %v, Cmd code = %v", res.OperationCode(), res.CommandCode())
+	}
+	if message, _ := res.GetString(DataCodeMessage); message != "Logged in elsewhere" {
+		t.Fatalf("kick message mismatch. %v", message)
+	}
+
+	buffer := make([]byte, 1024)
+	old_conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := old_conn.Read(buffer); err != io.EOF {
+		t.Fatalf("old connection not closed. %v", err)
+	}
+
+	if !errors.Is(old_client.DisconnectReason(), ErrClientKicked) {
+		t.Fatalf("disconnect reason mismatch. %v", old_client.DisconnectReason())
+	}
+
+	// 舊連線關閉後不可移除新連線的登入紀錄
+	for retry := 0; server.ClientRegistry.Count() != 1; retry++ {
+		if retry > 100 {
+			t.Fatal("old client not removed")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	clients := server.ClientRegistry.List()
+	server.loginLock.Lock()
+	current := server.logins["player-1"]
+	server.loginLock.Unlock()
+	if len(clients) != 1 || current != clients[0] || current == old_client {
+		t.Fatal("login record mismatch")
+	}
+}
+
+// 建立叢集節點，以獨立的 Redis 連線接上共用的 Redis
+func newClusterTestServer(t *testing.T, redisServer *miniredis.Miniredis, nodeID string) *SocketServer {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Cluster = ClusterSetting{
+			NodeID:      nodeID,
+			SingleLogin: true,
+			KeyPrefix:   "login:",
+			KickMessage: "Logged in elsewhere",
+			LoginTTL:    3,
+		}
+	})
+
+	port, _ := strconv.Atoi(redisServer.Port())
+	redisConn, err := database.NewRedisConnection(struct{ Login database.RedisConnSetting }{
+		Login: database.RedisConnSetting{Name: "login", Address: redisServer.Host(), Port: port, PoolSize: 4, DialTimeout: 5, ReadTimeout: 3, WriteTimeout: 3, PoolTimeout: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.redisConn = redisConn
+	server.AppSetting.Cluster.Redis = "login"
+	if err := server.setupCluster(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.AddOperation(&loginOperation{})
+	server.listen()
+	return server
+}
+
+func TestSingleLoginCluster(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+
+	nodeA := newClusterTestServer(t, redisServer, "node-a")
+	defer nodeA.close()
+	nodeB := newClusterTestServer(t, redisServer, "node-b")
+	defer nodeB.close()
+
+	old_conn, old_packer := loginTestClient(t, nodeA, "player-1")
+	defer old_conn.Close()
+	old_client := waitTestClients(t, nodeA, 1)[0]
+
+	if record, _ := redisServer.Get("login:player-1"); record != "node-a|"+old_client.ID() {
+		t.Fatalf("login record mismatch. %v", record)
+	}
+	if ttl := redisServer.TTL("login:player-1"); ttl <= 0 {
+		t.Fatalf("login record without ttl. %v", ttl)
+	}
+
+	// 在另一個節點登入，舊節點的連線被踢除
+	new_conn, _ := loginTestClient(t, nodeB, "player-1")
+	defer new_conn.Close()
+	new_client := waitTestClients(t, nodeB, 1)[0]
+
+	res := readTestResponse(t, old_conn, old_packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdKick {
+		t.Fatalf("kick notify mismatch. Op code = %v, Cmd code = %v", res.OperationCode(), res.CommandCode())
+	}
+
+	for retry := 0; nodeA.ClientRegistry.Count() != 0; retry++ {
+		if retry > 100 {
+			t.Fatal("kicked client not removed")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	if !errors.Is(old_client.DisconnectReason(), ErrClientKicked) {
+		t.Fatalf("disconnect reason mismatch. %v", old_client.DisconnectReason())
+	}
+
+	// 舊節點關閉連線時不可刪除新節點的登入紀錄
+	if record, _ := redisServer.Get("login:player-1"); record != "node-b|"+new_client.ID() {
+		t.Fatalf("login record overwritten by old node. %v", record)
+	}
+
+	// 新節點定時延長自己的登入紀錄
+	redisServer.SetTTL("login:player-1", time.Millisecond*100)
+	time.Sleep(time.Millisecond * 1500)
+	if ttl := redisServer.TTL("login:player-1"); ttl != time.Second*3 {
+		t.Fatalf("login record not refreshed. %v", ttl)
+	}
+
+	// 新節點的連線關閉後移除登入紀錄
+	new_conn.Close()
+	for retry := 0; redisServer.Exists("login:player-1"); retry++ {
+		if retry > 100 {
+			t.Fatal("login record not released")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
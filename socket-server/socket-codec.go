@@ -0,0 +1,381 @@
+package socketserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrCodecNotExist error = errors.New("codec not exist")
+
+const (
+	CodecJSON     = "json"
+	CodecMsgPack  = "msgpack"
+	CodecProtobuf = "protobuf"
+)
+
+// 請求資料編碼器
+type ICodec interface {
+	Name() string
+	Marshal(ReqData) ([]byte, error)
+	Unmarshal([]byte) (ReqData, error)
+}
+
+var codecLock sync.RWMutex
+var codecMap map[string]ICodec = map[string]ICodec{
+	CodecJSON:     JSONCodec{},
+	CodecMsgPack:  MsgPackCodec{},
+	CodecProtobuf: ProtobufCodec{},
+}
+
+// 註冊編碼器，相同名稱會覆蓋
+func RegisterCodec(codec ICodec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+
+	codecMap[strings.ToLower(codec.Name())] = codec
+}
+
+// 依照名稱取得編碼器
+func GetCodec(name string) (ICodec, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+
+	codec, isExist := codecMap[strings.ToLower(name)]
+	if !isExist {
+		return nil, fmt.Errorf("%w: %v", ErrCodecNotExist, name)
+	}
+
+	return codec, nil
+}
+
+// JSON 編碼器，數字一律解析為 float64
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(reqData ReqData) ([]byte, error) {
+	return json.Marshal(reqData)
+}
+
+func (JSONCodec) Unmarshal(data []byte) (reqData ReqData, err error) {
+	err = json.Unmarshal(data, &reqData)
+	return reqData, err
+}
+
+// MessagePack 編碼器，整數解析為 int64 (超出範圍時為 uint64)，浮點數解析為 float64
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) Name() string {
+	return CodecMsgPack
+}
+
+func (MsgPackCodec) Marshal(reqData ReqData) ([]byte, error) {
+	return msgpack.Marshal(reqData)
+}
+
+func (MsgPackCodec) Unmarshal(data []byte) (reqData ReqData, err error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.UseLooseInterfaceDecoding(true)
+
+	err = dec.Decode(&reqData)
+	for code, value := range reqData {
+		reqData[code] = msgpackNormalize(value)
+	}
+
+	return reqData, err
+}
+
+// MessagePack 的正整數一律以無號整數編碼，可放入 int64 的數值統一轉為 int64
+func msgpackNormalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = msgpackNormalize(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = msgpackNormalize(v[key])
+		}
+	}
+
+	return value
+}
+
+// Protobuf 編碼器
+//
+// ReqData 為動態資料，因此以下列結構直接編碼 protobuf wire format:
+//
+//	message ReqData   { map<uint32, Value> data = 1; }
+//	message ListValue { repeated Value values = 1; }
+//	message MapValue  { map<string, Value> fields = 1; }
+//	message Value {
+//		oneof kind {
+//			bool      null_value   = 1;
+//			bool      bool_value   = 2;
+//			sint64    int_value    = 3;
+//			uint64    uint_value   = 4;
+//			double    double_value = 5;
+//			string    string_value = 6;
+//			bytes     bytes_value  = 7;
+//			ListValue list_value   = 8;
+//			MapValue  map_value    = 9;
+//		}
+//	}
+//
+// 整數解析為 int64 / uint64，浮點數解析為 float64
+type ProtobufCodec struct{}
+
+const (
+	pbValueNull   protowire.Number = 1
+	pbValueBool   protowire.Number = 2
+	pbValueInt    protowire.Number = 3
+	pbValueUint   protowire.Number = 4
+	pbValueDouble protowire.Number = 5
+	pbValueString protowire.Number = 6
+	pbValueBytes  protowire.Number = 7
+	pbValueList   protowire.Number = 8
+	pbValueMap    protowire.Number = 9
+)
+
+func (ProtobufCodec) Name() string {
+	return CodecProtobuf
+}
+
+func (ProtobufCodec) Marshal(reqData ReqData) (data []byte, err error) {
+	for code, value := range reqData {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.VarintType)
+		entry = protowire.AppendVarint(entry, uint64(code))
+
+		entry, err = pbAppendValueField(entry, 2, value)
+		if err != nil {
+			return nil, fmt.Errorf("data code %v: %w", code, err)
+		}
+
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, entry)
+	}
+
+	return data, nil
+}
+
+func (ProtobufCodec) Unmarshal(data []byte) (ReqData, error) {
+	reqData := make(ReqData)
+
+	err := pbRangeFields(data, func(num protowire.Number, typ protowire.Type, field []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		var code uint64
+		var value interface{}
+		err := pbRangeFields(field, func(num protowire.Number, typ protowire.Type, field []byte) (err error) {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				code, _ = protowire.ConsumeVarint(field)
+			case num == 2 && typ == protowire.BytesType:
+				value, err = pbParseValue(field)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if code > math.MaxUint16 {
+			return fmt.Errorf("protobuf data code overflow: %v", code)
+		}
+
+		reqData[DataCode(code)] = value
+		return nil
+	})
+
+	return reqData, err
+}
+
+// 將資料編碼為 Value 訊息並寫入指定欄位
+func pbAppendValueField(b []byte, num protowire.Number, value interface{}) ([]byte, error) {
+	valueData, err := pbAppendValue(nil, value)
+	if err != nil {
+		return b, err
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, valueData), nil
+}
+
+// 編碼 Value 訊息內容
+func pbAppendValue(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		b = protowire.AppendTag(b, pbValueNull, protowire.VarintType)
+		return protowire.AppendVarint(b, 1), nil
+	case bool:
+		b = protowire.AppendTag(b, pbValueBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v)), nil
+	case string:
+		b = protowire.AppendTag(b, pbValueString, protowire.BytesType)
+		return protowire.AppendString(b, v), nil
+	case []byte:
+		b = protowire.AppendTag(b, pbValueBytes, protowire.BytesType)
+		return protowire.AppendBytes(b, v), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = protowire.AppendTag(b, pbValueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = protowire.AppendTag(b, pbValueUint, protowire.VarintType)
+		return protowire.AppendVarint(b, rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		b = protowire.AppendTag(b, pbValueDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(rv.Float())), nil
+	case reflect.String:
+		b = protowire.AppendTag(b, pbValueString, protowire.BytesType)
+		return protowire.AppendString(b, rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		var list []byte
+		for i := 0; i < rv.Len(); i++ {
+			var err error
+			list, err = pbAppendValueField(list, 1, rv.Index(i).Interface())
+			if err != nil {
+				return b, err
+			}
+		}
+
+		b = protowire.AppendTag(b, pbValueList, protowire.BytesType)
+		return protowire.AppendBytes(b, list), nil
+	case reflect.Map:
+		var fields []byte
+		iter := rv.MapRange()
+		for iter.Next() {
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendString(entry, fmt.Sprint(iter.Key().Interface()))
+
+			var err error
+			entry, err = pbAppendValueField(entry, 2, iter.Value().Interface())
+			if err != nil {
+				return b, err
+			}
+
+			fields = protowire.AppendTag(fields, 1, protowire.BytesType)
+			fields = protowire.AppendBytes(fields, entry)
+		}
+
+		b = protowire.AppendTag(b, pbValueMap, protowire.BytesType)
+		return protowire.AppendBytes(b, fields), nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return pbAppendValue(b, nil)
+		}
+		return pbAppendValue(b, rv.Elem().Interface())
+	}
+
+	return b, fmt.Errorf("protobuf codec unsupported type %T", value)
+}
+
+// 解析 Value 訊息
+func pbParseValue(data []byte) (value interface{}, err error) {
+	err = pbRangeFields(data, func(num protowire.Number, typ protowire.Type, field []byte) (err error) {
+		switch num {
+		case pbValueNull:
+			value = nil
+		case pbValueBool:
+			v, _ := protowire.ConsumeVarint(field)
+			value = protowire.DecodeBool(v)
+		case pbValueInt:
+			v, _ := protowire.ConsumeVarint(field)
+			value = protowire.DecodeZigZag(v)
+		case pbValueUint:
+			value, _ = protowire.ConsumeVarint(field)
+		case pbValueDouble:
+			v, _ := protowire.ConsumeFixed64(field)
+			value = math.Float64frombits(v)
+		case pbValueString:
+			value = string(field)
+		case pbValueBytes:
+			value = append([]byte{}, field...)
+		case pbValueList:
+			list := make([]interface{}, 0)
+			err = pbRangeFields(field, func(num protowire.Number, typ protowire.Type, field []byte) error {
+				item, err := pbParseValue(field)
+				list = append(list, item)
+				return err
+			})
+			value = list
+		case pbValueMap:
+			fields := make(map[string]interface{})
+			err = pbRangeFields(field, func(num protowire.Number, typ protowire.Type, field []byte) error {
+				var key string
+				var item interface{}
+				err := pbRangeFields(field, func(num protowire.Number, typ protowire.Type, field []byte) (err error) {
+					switch num {
+					case 1:
+						key = string(field)
+					case 2:
+						item, err = pbParseValue(field)
+					}
+					return err
+				})
+				fields[key] = item
+				return err
+			})
+			value = fields
+		}
+		return err
+	})
+
+	return value, err
+}
+
+// 依序走訪訊息中的所有欄位，field 為欄位內容 (Varint / Fixed 型別則為原始編碼)
+func pbRangeFields(data []byte, fn func(protowire.Number, protowire.Type, []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var field []byte
+		switch typ {
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return protowire.ParseError(m)
+			}
+			field, n = v, m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field = data[:n]
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
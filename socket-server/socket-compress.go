@@ -0,0 +1,143 @@
+package socketserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var ErrCompressionInvalid error = errors.New("compression invalid")
+var ErrDecompressOverflow error = errors.New("decompressed size over limit")
+
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+// 封包標記
+const (
+	FrameFlagSnappy byte = 0x01 // 封包內容以 snappy 壓縮
+	FrameFlagZstd   byte = 0x02 // 封包內容以 zstd 壓縮
+
+	frameFlagCompressMask byte = 0x03
+)
+
+// 固定以單一區段編碼，宣告的視窗大小即為內容大小，解壓端才能以大小上限拒絕過大的視窗
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithSingleSegment(true))
+
+// 依解壓縮大小上限分開的解碼器池，解碼器的視窗與記憶體用量不可超過上限
+var zstdDecoderPools sync.Map
+
+// 取得指定大小上限的解碼器池，maxSize 為 0 時不限制
+func zstdDecoderPool(maxSize int) *sync.Pool {
+	if pool, isExist := zstdDecoderPools.Load(maxSize); isExist {
+		return pool.(*sync.Pool)
+	}
+
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if maxSize > 0 {
+		// 視窗大小至少需 1 KB
+		limit := uint64(maxSize)
+		if limit < zstd.MinWindowSize {
+			limit = zstd.MinWindowSize
+		}
+		options = append(options, zstd.WithDecoderMaxWindow(limit), zstd.WithDecoderMaxMemory(limit))
+	}
+
+	pool, _ := zstdDecoderPools.LoadOrStore(maxSize, &sync.Pool{
+		New: func() interface{} {
+			decoder, _ := zstd.NewReader(nil, options...)
+			return decoder
+		},
+	})
+
+	return pool.(*sync.Pool)
+}
+
+// 依照名稱取得壓縮標記
+func compressionFlag(name string) (byte, error) {
+	switch strings.ToLower(name) {
+	case CompressionNone, "", "empty":
+		return 0, nil
+	case CompressionSnappy:
+		return FrameFlagSnappy, nil
+	case CompressionZstd:
+		return FrameFlagZstd, nil
+	}
+
+	return 0, fmt.Errorf("%w: %v", ErrCompressionInvalid, name)
+}
+
+// 壓縮封包內容
+func compressFrame(flag byte, data []byte) []byte {
+	switch flag {
+	case FrameFlagSnappy:
+		return snappy.Encode(nil, data)
+	case FrameFlagZstd:
+		return zstdEncoder.EncodeAll(data, nil)
+	}
+
+	return data
+}
+
+// 解壓縮封包內容，解壓後超過 maxSize 即中止，避免小封包解壓耗盡記憶體
+func decompressFrame(flags byte, data []byte, maxSize int) ([]byte, error) {
+	switch flags & frameFlagCompressMask {
+	case 0:
+		return data, nil
+	case FrameFlagSnappy:
+		decodedLen, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if maxSize > 0 && decodedLen > maxSize {
+			return nil, fmt.Errorf("%w: %v > %v", ErrDecompressOverflow, decodedLen, maxSize)
+		}
+
+		return snappy.Decode(nil, data)
+	case FrameFlagZstd:
+		pool := zstdDecoderPool(maxSize)
+		decoder := pool.Get().(*zstd.Decoder)
+		defer pool.Put(decoder)
+
+		// 宣告的視窗超過上限時在配置記憶體前就會被拒絕
+		if err := decoder.Reset(bytes.NewReader(data)); err != nil {
+			return nil, zstdError(err, maxSize)
+		}
+
+		var reader io.Reader = decoder
+		if maxSize > 0 {
+			reader = io.LimitReader(decoder, int64(maxSize)+1)
+		}
+
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, zstdError(err, maxSize)
+		}
+
+		if maxSize > 0 && len(decoded) > maxSize {
+			return nil, fmt.Errorf("%w: over %v", ErrDecompressOverflow, maxSize)
+		}
+
+		return decoded, nil
+	}
+
+	return nil, fmt.Errorf("%w: flags %v", ErrCompressionInvalid, flags)
+}
+
+// 將超過視窗或記憶體上限的解碼錯誤轉為 ErrDecompressOverflow
+func zstdError(err error, maxSize int) error {
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return fmt.Errorf("%w: zstd window over %v. %v", ErrDecompressOverflow, maxSize, err)
+	}
+
+	return err
+}
@@ -0,0 +1,314 @@
+package socketserver
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var ErrEncryptionInvalid error = errors.New("encryption invalid")
+var ErrHandshakeFail error = errors.New("encryption handshake fail")
+var ErrHandshakeKeyInvalid error = errors.New("handshake key invalid")
+
+const (
+	EncryptionNone     = "none"
+	EncryptionAESGCM   = "aes-gcm"
+	EncryptionChaCha20 = "chacha20-poly1305"
+)
+
+const (
+	handshakeVersion       byte = 1 // 未簽章的金鑰交換
+	handshakeVersionSigned byte = 2 // 伺服器以固定金鑰簽署臨時公鑰
+	handshakeSignContext        = "AndyGameServerGo handshake"
+
+	cipherIDAESGCM   byte = 1
+	cipherIDChaCha20 byte = 2
+
+	handshakeKeySize = curve25519.PointSize
+	handshakeInfo    = "AndyGameServerGo session keys"
+)
+
+// 依照名稱取得加密方式編號，0 為不加密
+func encryptionID(name string) (byte, error) {
+	switch strings.ToLower(name) {
+	case EncryptionNone, "", "empty":
+		return 0, nil
+	case EncryptionAESGCM:
+		return cipherIDAESGCM, nil
+	case EncryptionChaCha20:
+		return cipherIDChaCha20, nil
+	}
+
+	return 0, fmt.Errorf("%w: %v", ErrEncryptionInvalid, name)
+}
+
+// 封包加密器
+//
+// 兩個方向使用不同的金鑰，nonce 為各方向遞增的計數器，
+// 因此封包被重送、重排或竄改都會驗證失敗
+type FrameCipher struct {
+	sync.Mutex
+
+	sendAEAD  cipher.AEAD
+	recvAEAD  cipher.AEAD
+	sendNonce uint64
+	recvNonce uint64
+}
+
+// 加密後增加的長度
+func (c *FrameCipher) Overhead() int {
+	return c.sendAEAD.Overhead()
+}
+
+// 加密封包內容，additional 為不加密但需驗證的資料
+func (c *FrameCipher) Seal(plain, additional []byte) []byte {
+	c.Lock()
+	defer c.Unlock()
+
+	nonce := makeNonce(c.sendAEAD.NonceSize(), c.sendNonce)
+	c.sendNonce++
+
+	return c.sendAEAD.Seal(nil, nonce, plain, additional)
+}
+
+// 解密並驗證封包內容
+func (c *FrameCipher) Open(sealed, additional []byte) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	nonce := makeNonce(c.recvAEAD.NonceSize(), c.recvNonce)
+	plain, err := c.recvAEAD.Open(nil, nonce, sealed, additional)
+	if err != nil {
+		return nil, ErrFrameAuthFail
+	}
+
+	c.recvNonce++
+	return plain, nil
+}
+
+func makeNonce(size int, counter uint64) []byte {
+	nonce := make([]byte, size)
+	binary.LittleEndian.PutUint64(nonce[size-8:], counter)
+	return nonce
+}
+
+func newAEAD(cipherID byte, key []byte) (cipher.AEAD, error) {
+	switch cipherID {
+	case cipherIDAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case cipherIDChaCha20:
+		return chacha20poly1305.New(key)
+	}
+
+	return nil, fmt.Errorf("%w: cipher id %v", ErrEncryptionInvalid, cipherID)
+}
+
+// 由雙方公鑰與共享秘密衍生兩個方向的金鑰
+func newFrameCipher(cipherID byte, shared, serverKey, clientKey []byte, isServer bool) (*FrameCipher, error) {
+	salt := append(append([]byte{}, serverKey...), clientKey...)
+	reader := hkdf.New(sha256.New, shared, salt, []byte(handshakeInfo))
+
+	clientToServer := make([]byte, 32)
+	serverToClient := make([]byte, 32)
+	if _, err := io.ReadFull(reader, clientToServer); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(reader, serverToClient); err != nil {
+		return nil, err
+	}
+
+	sendKey, recvKey := clientToServer, serverToClient
+	if isServer {
+		sendKey, recvKey = serverToClient, clientToServer
+	}
+
+	sendAEAD, err := newAEAD(cipherID, sendKey)
+	if err != nil {
+		return nil, err
+	}
+
+	recvAEAD, err := newAEAD(cipherID, recvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FrameCipher{
+		sendAEAD: sendAEAD,
+		recvAEAD: recvAEAD,
+	}, nil
+}
+
+// 讀取 PKCS#8 PEM 格式的 Ed25519 私鑰，供伺服器簽署金鑰交換
+func LoadHandshakeKey(path string) (ed25519.PrivateKey, error) {
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("%w: pem not found in %v", ErrHandshakeKeyInvalid, path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeKeyInvalid, err)
+	}
+
+	privateKey, isEd25519 := key.(ed25519.PrivateKey)
+	if !isEd25519 {
+		return nil, fmt.Errorf("%w: not ed25519 key", ErrHandshakeKeyInvalid)
+	}
+
+	return privateKey, nil
+}
+
+// 解析 PKIX PEM 格式的 Ed25519 公鑰，供客戶端固定伺服器的簽署金鑰
+func ParseHandshakePublicKey(pemData []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("%w: pem not found", ErrHandshakeKeyInvalid)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeKeyInvalid, err)
+	}
+
+	publicKey, isEd25519 := key.(ed25519.PublicKey)
+	if !isEd25519 {
+		return nil, fmt.Errorf("%w: not ed25519 key", ErrHandshakeKeyInvalid)
+	}
+
+	return publicKey, nil
+}
+
+// 簽章涵蓋的內容，包含版本與加密方式，避免被降級
+func handshakeSignData(version, cipherID byte, publicKey []byte) []byte {
+	data := append([]byte(handshakeSignContext), version, cipherID)
+	return append(data, publicKey...)
+}
+
+func generateKeyPair() (privateKey, publicKey []byte, err error) {
+	privateKey = make([]byte, curve25519.ScalarSize)
+	if _, err = rand.Read(privateKey); err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err = curve25519.X25519(privateKey, curve25519.Basepoint)
+	return privateKey, publicKey, err
+}
+
+// 伺服器端金鑰交換
+//
+// 伺服器送出 [版本 1 byte][加密方式 1 byte][臨時公鑰 32 bytes]，有簽署金鑰時版本為 2 並附上 [簽章 64 bytes]，
+// 客戶端回覆 [臨時公鑰 32 bytes]，之後所有封包皆以協商出的金鑰加密。
+//
+// 威脅模型: 未設定 signKey 時只能防止被動竊聽，主動的中間人可以分別與雙方交換金鑰並讀取、竄改所有封包。
+// 設定 signKey 且客戶端固定對應的公鑰後，中間人無法偽造伺服器的臨時公鑰，也無法將連線降級為未簽章。
+// 此交換只驗證伺服器，客戶端身分仍需由登入流程確認；臨時金鑰每次連線重新產生，簽署金鑰外洩不影響過去的連線
+func ServerHandshake(conn net.Conn, encryption string, signKey ed25519.PrivateKey, timeout time.Duration) (*FrameCipher, error) {
+	cipherID, err := encryptionID(encryption)
+	if err != nil || cipherID == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrEncryptionInvalid, encryption)
+	}
+
+	privateKey, publicKey, err := generateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := append([]byte{handshakeVersion, cipherID}, publicKey...)
+	if signKey != nil {
+		hello[0] = handshakeVersionSigned
+		hello = append(hello, ed25519.Sign(signKey, handshakeSignData(handshakeVersionSigned, cipherID, publicKey))...)
+	}
+
+	if _, err = conn.Write(hello); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	clientKey := make([]byte, handshakeKeySize)
+	if _, err = io.ReadFull(conn, clientKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	shared, err := curve25519.X25519(privateKey, clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	return newFrameCipher(cipherID, shared, publicKey, clientKey, true)
+}
+
+// 客戶端金鑰交換，與 ServerHandshake 對應
+//
+// serverKey 為固定的伺服器簽署公鑰，設定後拒絕未簽章或簽章錯誤的伺服器；為 nil 時不驗證伺服器，無法防止中間人
+func ClientHandshake(conn net.Conn, serverKey ed25519.PublicKey, timeout time.Duration) (*FrameCipher, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := make([]byte, 2+handshakeKeySize)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	switch hello[0] {
+	case handshakeVersion:
+		if serverKey != nil {
+			return nil, fmt.Errorf("%w: server handshake not signed", ErrHandshakeFail)
+		}
+	case handshakeVersionSigned:
+		signature := make([]byte, ed25519.SignatureSize)
+		if _, err := io.ReadFull(conn, signature); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+		}
+
+		if serverKey != nil && !ed25519.Verify(serverKey, handshakeSignData(hello[0], hello[1], hello[2:]), signature) {
+			return nil, fmt.Errorf("%w: server signature invalid", ErrHandshakeFail)
+		}
+	default:
+		return nil, fmt.Errorf("%w: version %v", ErrHandshakeFail, hello[0])
+	}
+
+	privateKey, publicKey, err := generateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = conn.Write(publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	serverPublicKey := hello[2:]
+	shared, err := curve25519.X25519(privateKey, serverPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFail, err)
+	}
+
+	return newFrameCipher(hello[1], shared, serverPublicKey, publicKey, false)
+}
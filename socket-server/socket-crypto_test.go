@@ -0,0 +1,129 @@
+package socketserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncryptedSession(t *testing.T) {
+	for _, encryption := range []string{EncryptionAESGCM, EncryptionChaCha20} {
+		server := newTestServer(t, func(setting *AppSetting) {
+			setting.Server.Encryption = encryption
+			setting.Server.HandshakeTimeOut = 5
+		})
+		server.listen()
+
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frameCipher, err := ClientHandshake(conn, nil, time.Second*5)
+		if err != nil {
+			t.Fatal(encryption, err)
+		}
+
+		packer := NewPacket(nil)
+		packer.SetCipher(frameCipher)
+
+		for i := 0; i < 3; i++ {
+			req := NewSocketRequest(OperationCode(1), CommandCode(i))
+			req.Set(DataCode(0), "sniff me")
+			bd, _ := packer.PackRequest(req)
+			if _, err := conn.Write(bd); err != nil {
+				t.Fatal(encryption, err)
+			}
+
+			res := readTestResponse(t, conn, packer)
+			if data, _ := res.GetString(DataCode(0)); data != "sniff me" || res.CommandCode() != CommandCode(i) {
+				t.Errorf("%v echo mismatch. %v", encryption, res)
+			}
+		}
+
+		// 竄改封包內容後伺服器必須斷線
+		req := NewSocketRequest(OperationCode(1), CommandCode(9))
+		bd, _ := packer.PackRequest(req)
+		bd[len(bd)-1] ^= 0xFF
+		conn.Write(bd)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, io.EOF) {
+			t.Errorf("%v tampered frame not rejected", encryption)
+		}
+
+		conn.Close()
+		server.close()
+	}
+}
+
+// 以 net.Pipe 執行雙方金鑰交換，回傳客戶端的錯誤
+func pipeHandshake(signKey ed25519.PrivateKey, serverKey ed25519.PublicKey) error {
+	server_conn, client_conn := net.Pipe()
+	defer server_conn.Close()
+	defer client_conn.Close()
+
+	go ServerHandshake(server_conn, EncryptionAESGCM, signKey, time.Second)
+
+	_, err := ClientHandshake(client_conn, serverKey, time.Second)
+	return err
+}
+
+func TestSignedHandshake(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		name      string
+		signKey   ed25519.PrivateKey
+		serverKey ed25519.PublicKey
+		isOK      bool
+	}{
+		{"signed pinned", privateKey, publicKey, true},
+		{"signed unpinned", privateKey, nil, true},
+		{"unsigned unpinned", nil, nil, true},
+		{"wrong key", privateKey, otherKey, false},
+		{"downgrade", nil, publicKey, false},
+	}
+
+	for _, c := range cases {
+		err := pipeHandshake(c.signKey, c.serverKey)
+		if c.isOK && err != nil {
+			t.Errorf("%v handshake fail. %v", c.name, err)
+		}
+		if !c.isOK && !errors.Is(err, ErrHandshakeFail) {
+			t.Errorf("%v handshake should fail. %v", c.name, err)
+		}
+	}
+}
+
+func TestHandshakeKeyFile(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	keyFile := filepath.Join(t.TempDir(), "handshake.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600)
+
+	loaded, err := LoadHandshakeKey(keyFile)
+	if err != nil || !loaded.Equal(privateKey) {
+		t.Fatalf("load handshake key fail. %v", err)
+	}
+
+	publicDER, _ := x509.MarshalPKIXPublicKey(publicKey)
+	parsed, err := ParseHandshakePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil || !parsed.Equal(publicKey) {
+		t.Fatalf("parse handshake public key fail. %v", err)
+	}
+
+	if _, err := ParseHandshakePublicKey([]byte("not pem")); !errors.Is(err, ErrHandshakeKeyInvalid) {
+		t.Errorf("invalid pem accepted. %v", err)
+	}
+}
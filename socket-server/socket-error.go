@@ -1,7 +1,53 @@
 package socketserver
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrClientIDDuplicate error = errors.New("client id duplicate")
 var ErrClientStop error = errors.New("client close connect")
 var ErrConnectTimeOut error = errors.New("connection time out")
+var ErrTLSModeInvalid error = errors.New("tls mode invalid")
+var ErrTLSCertNotSet error = errors.New("tls certificate or key file not set")
+var ErrFrameAuthFail error = errors.New("frame authentication fail")
+var ErrClientRejected error = errors.New("client rejected by version check")
+var ErrClientUpgradeRequired error = errors.New("client upgrade required")
+var ErrOperationCodeReserved error = errors.New("operation code reserved")
+var ErrFrameTooSmall error = errors.New("frame length too small")
+var ErrFrameTooLarge error = errors.New("frame length too large")
+var ErrFrameMalformed error = errors.New("frame malformed")
+var ErrTooManyMalformedFrames error = errors.New("too many malformed frames")
+var ErrResumeExpired error = errors.New("resume grace time expired")
+var ErrResumeOverflow error = errors.New("resume pending frames overflow")
+var ErrSessionResumed error = errors.New("connection resumed to previous session")
+var ErrClientKicked error = errors.New("client kicked")
+var ErrServerShutdown error = errors.New("server shutdown")
+var ErrServerBusy error = errors.New("server busy")
+var ErrSlowConsumer error = errors.New("client write queue over high water mark")
+var ErrLoginTimeOut error = errors.New("login time out")
+var ErrPingTimeOut error = errors.New("ping time out")
+var ErrClusterRedisNotSet error = errors.New("cluster redis connection not set")
+var ErrOperationPanic error = errors.New("operation panic")
+var ErrQueueFullInvalid error = errors.New("queue full policy invalid")
+var ErrRateLimitInvalid error = errors.New("rate limit action invalid")
+var ErrRoomExist error = errors.New("room already exist")
+var ErrRoomNotExist error = errors.New("room not exist")
+var ErrRoomJoined error = errors.New("client already in room")
+var ErrRoomNotJoined error = errors.New("client not in room")
+
+// 封包解析錯誤
+type FrameError struct {
+	Reason string // 錯誤原因
+	Length int32  // 封包宣告的長度
+	Fatal  bool   // 資料流已無法繼續解析，必須中斷連線
+	Err    error
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame error: %v (length = %v, fatal = %v) => %v", e.Reason, e.Length, e.Fatal, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,118 @@
+package socketserver
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// 定時發送心跳並檢查回覆，連續未回覆達上限即中斷連線，連線被關閉或被替換時結束
+func (client *SocketClient) heartbeatLoop(conn net.Conn) {
+	setting := client.server.AppSetting.Server
+	if setting.PingInterval <= 0 {
+		return
+	}
+
+	// 恢復連線時不計算舊連線未回覆的心跳
+	client.Lock()
+	client.pingID = 0
+	client.pingMissed = 0
+	client.Unlock()
+
+	ticker := time.NewTicker(time.Second * time.Duration(setting.PingInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.conn_ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if client.currentConn() != conn {
+			return
+		}
+
+		client.Lock()
+		if client.pingID != 0 {
+			client.pingMissed++
+		}
+		missed := client.pingMissed
+		client.Unlock()
+
+		if setting.PingMaxMissed > 0 && missed >= setting.PingMaxMissed {
+			client.logger.Warn(fmt.Sprintf("Client %v missed %v pongs", client.id, missed))
+			client.disconnect(conn, ErrPingTimeOut)
+			return
+		}
+
+		if err := client.ping(); err != nil {
+			client.logger.Warn(fmt.Sprintf("Client %v ping fail. %v", client.id, err.Error()))
+		}
+	}
+}
+
+// 發送心跳，未回覆前再次發送時以新的心跳為準
+func (client *SocketClient) ping() error {
+	reqID := client.NextRequestID()
+	now := time.Now()
+
+	client.Lock()
+	client.pingID = reqID
+	client.pingTime = now
+	client.Unlock()
+
+	return client.send(reqID, now, OpCodeSystem, CmdPing, ReqData{})
+}
+
+// 回覆客戶端發出的心跳，沿用請求編號與時間供客戶端計算延遲
+func (client *SocketClient) handlePing(req *SocketRequest) {
+	err := client.send(req.GetID(), req.GetRequestTime(), OpCodeSystem, CmdPong, ReqData{})
+	if err != nil {
+		client.logger.Warn(fmt.Sprintf("Client %v pong fail. %v", client.id, err.Error()))
+	}
+}
+
+// 處理客戶端的心跳回覆，依 RFC 6298 更新平滑延遲與抖動
+func (client *SocketClient) handlePong(req *SocketRequest) {
+	client.Lock()
+	defer client.Unlock()
+
+	if client.pingID == 0 || req.GetID() != client.pingID {
+		return
+	}
+
+	rtt := time.Since(client.pingTime)
+	client.pingID = 0
+	client.pingMissed = 0
+
+	if client.srtt == 0 {
+		client.srtt = rtt
+		client.rttvar = rtt / 2
+		return
+	}
+
+	diff := client.srtt - rtt
+	if diff < 0 {
+		diff = -diff
+	}
+
+	client.rttvar = (3*client.rttvar + diff) / 4
+	client.srtt = (7*client.srtt + rtt) / 8
+}
+
+// 取得平滑後的來回延遲，尚未收到心跳回覆時為 0
+func (client *SocketClient) RTT() time.Duration {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.srtt
+}
+
+// 取得來回延遲的抖動，尚未收到心跳回覆時為 0
+func (client *SocketClient) Jitter() time.Duration {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.rttvar
+}
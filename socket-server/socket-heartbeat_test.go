@@ -0,0 +1,113 @@
+package socketserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatSmoothing(t *testing.T) {
+	client := &SocketClient{}
+	for _, rtt := range []time.Duration{time.Millisecond * 100, time.Millisecond * 200} {
+		client.pingID = ReqID(1)
+		client.pingTime = time.Now().Add(-rtt)
+		client.handlePong(&SocketRequest{id: ReqID(1)})
+	}
+
+	// 第一次 srtt = 100, rttvar = 50；第二次 rttvar = (3*50+100)/4, srtt = (7*100+200)/8
+	if srtt := client.RTT(); srtt < time.Microsecond*112500 || srtt > time.Millisecond*115 {
+		t.Fatalf("srtt mismatch. %v", srtt)
+	}
+	if jitter := client.Jitter(); jitter < time.Microsecond*62500 || jitter > time.Millisecond*65 {
+		t.Fatalf("jitter mismatch. %v", jitter)
+	}
+
+	// 過期的心跳回覆不列入計算
+	client.handlePong(&SocketRequest{id: ReqID(1)})
+	if client.pingMissed != 0 || client.pingID != 0 {
+		t.Fatal("stale pong changed state")
+	}
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.PingInterval = 1
+		setting.Server.PingMaxMissed = 2
+	})
+	defer server.close()
+
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 客戶端發出的心跳以相同編號回覆
+	packer := NewPacket(nil)
+	bd, _ := packer.PackFrame(ReqID(5), time.Now(), OpCodeSystem, CmdPing, ReqData{})
+	conn.Write(bd)
+
+	res := readTestResponse(t, conn, packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdPong || res.GetID() != ReqID(5) {
+		t.Fatalf("pong mismatch. Cmd code = %v, id = %v", res.CommandCode(), res.GetID())
+	}
+
+	res = readTestResponse(t, conn, packer)
+	if res.OperationCode() != OpCodeSystem || res.CommandCode() != CmdPing {
+		t.Fatalf("ping mismatch. Cmd code = %v", res.CommandCode())
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	bd, _ = packer.PackFrame(res.GetID(), time.Now(), OpCodeSystem, CmdPong, ReqData{})
+	conn.Write(bd)
+
+	client := waitTestClients(t, server, 1)[0]
+	for retry := 0; client.RTT() == 0; retry++ {
+		if retry > 100 {
+			t.Fatal("rtt not recorded")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	if rtt := client.RTT(); rtt < time.Millisecond*20 || client.Jitter() != rtt/2 {
+		t.Fatalf("rtt mismatch. rtt = %v, jitter = %v", rtt, client.Jitter())
+	}
+}
+
+func TestHeartbeatTimeOut(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.PingInterval = 1
+		setting.Server.PingMaxMissed = 1
+	})
+	defer server.close()
+
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := waitTestClients(t, server, 1)[0]
+
+	// 收到心跳但不回覆
+	packer := NewPacket(nil)
+	if res := readTestResponse(t, conn, packer); res.CommandCode() != CmdPing {
+		t.Fatalf("ping mismatch. Cmd code = %v", res.CommandCode())
+	}
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := conn.Read(buffer); err != io.EOF {
+		t.Fatalf("connection not closed after missed pong. %v", err)
+	}
+
+	if !errors.Is(client.DisconnectReason(), ErrPingTimeOut) {
+		t.Fatalf("disconnect reason mismatch. %v", client.DisconnectReason())
+	}
+}
@@ -0,0 +1,39 @@
+package socketserver
+
+import (
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// 建立 KCP 監聽
+//
+// KCP 在 UDP 上提供 ARQ 重傳，每個 UDPSession 都實作 net.Conn，
+// 因此可以直接作為 SocketClient 的連接口，封包格式與 TCP 完全相同
+func (server *SocketServer) listenKCP(address string) error {
+	setting := server.AppSetting.KCP
+
+	listener, err := kcp.ListenWithOptions(address, nil, setting.DataShards, setting.ParityShards)
+	if err != nil {
+		return err
+	}
+
+	listener.SetReadBuffer(server.AppSetting.Server.ReadBuffer * setting.RecvWindow)
+	listener.SetWriteBuffer(server.AppSetting.Server.WriteBuffer * setting.SendWindow)
+
+	server.kcpListener = listener
+
+	return nil
+}
+
+// 設定KCP連線參數
+func (client *SocketClient) setupKCP(session *kcp.UDPSession) {
+	setting := client.server.AppSetting.KCP
+
+	session.SetNoDelay(setting.NoDelay, setting.Interval, setting.Resend, setting.NoCongestion)
+	session.SetWindowSize(setting.SendWindow, setting.RecvWindow)
+	session.SetACKNoDelay(setting.AckNoDelay)
+	session.SetStreamMode(setting.StreamMode)
+
+	if !session.SetMtu(setting.MTU) {
+		client.logger.Warn("on setting kcp mtu", setting.MTU)
+	}
+}
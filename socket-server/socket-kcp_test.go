@@ -0,0 +1,50 @@
+package socketserver
+
+import (
+	"testing"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+func TestKCPEcho(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.KCP = KCPSetting{
+			NoDelay:      1,
+			Interval:     10,
+			Resend:       2,
+			NoCongestion: 1,
+			SendWindow:   128,
+			RecvWindow:   128,
+			MTU:          1350,
+			AckNoDelay:   true,
+			StreamMode:   true,
+		}
+	})
+	defer server.close()
+
+	if err := server.listenKCP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	server.listen()
+
+	conn, err := kcp.DialWithOptions(server.kcpListener.Addr().String(), nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetStreamMode(true)
+
+	req := NewSocketRequest(OperationCode(1), CommandCode(5))
+	req.Set(DataCode(2), "udp")
+
+	packer := NewPacket(nil)
+	bd, _ := packer.PackRequest(req)
+	if _, err := conn.Write(bd); err != nil {
+		t.Fatal(err)
+	}
+
+	res := readTestResponse(t, conn, packer)
+	if data, _ := res.Get(DataCode(2)); data != "udp" {
+		t.Errorf("echo data mismatch. %v", data)
+	}
+}
@@ -0,0 +1,57 @@
+package socketserver
+
+// 依序執行此客戶端的請求，不同客戶端之間仍會同時執行
+func (client *SocketClient) dispatch(req *SocketRequest) {
+	if client.server.isUnordered(req.OperationCode()) {
+		client.server.submit(client, req, nil)
+		return
+	}
+
+	client.mailboxOnce.Do(func() {
+		go client.runMailbox()
+	})
+
+	// 信箱已滿時暫停讀取，直到前面的請求執行完畢
+	select {
+	case client.mailbox <- req:
+	case <-client.closed:
+	}
+}
+
+// 逐一執行信箱中的請求，客戶端關閉時結束
+func (client *SocketClient) runMailbox() {
+	for {
+		select {
+		case req := <-client.mailbox:
+			done := make(chan struct{})
+			if !client.server.submit(client, req, done) {
+				continue
+			}
+
+			// 等待執行完畢才處理下一個請求
+			select {
+			case <-done:
+			case <-client.closed:
+				return
+			case <-client.server.ctx.Done():
+				return
+			}
+		case <-client.closed:
+			return
+		}
+	}
+}
+
+// 設定流程不需依序執行，例如唯讀的查詢流程，需在伺服器啟動前設定
+func (server *SocketServer) SetUnorderedOperation(opCode OperationCode, unordered bool) {
+	if unordered {
+		server.unordered[opCode] = true
+	} else {
+		delete(server.unordered, opCode)
+	}
+}
+
+// 流程是否不需依序執行
+func (server *SocketServer) isUnordered(opCode OperationCode) bool {
+	return server.unordered[opCode]
+}
@@ -0,0 +1,89 @@
+package socketserver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 記錄執行順序與同時執行數量的流程器
+type orderOperation struct {
+	echoOperation
+	sync.Mutex
+
+	delay      time.Duration
+	order      []int64
+	running    int
+	maxRunning int
+}
+
+func (op *orderOperation) Command(ctx context.Context, req *SocketRequest) error {
+	op.Lock()
+	op.running++
+	if op.running > op.maxRunning {
+		op.maxRunning = op.running
+	}
+	op.Unlock()
+
+	time.Sleep(op.delay)
+
+	seq, _ := req.GetInt64(DataCode(0))
+	op.Lock()
+	op.order = append(op.order, seq)
+	op.running--
+	op.Unlock()
+
+	return req.Response(req.reqData)
+}
+
+func TestMailboxOrder(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	ordered := &orderOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, delay: time.Millisecond * 5}
+	unordered := &orderOperation{echoOperation: echoOperation{opCode: OperationCode(3)}, delay: time.Millisecond * 100}
+	server.AddOperation(ordered)
+	server.AddOperation(unordered)
+	server.SetUnorderedOperation(OperationCode(3), true)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packer := NewPacket(nil)
+	const count = 10
+	for i := 1; i <= count; i++ {
+		bd, _ := packer.PackFrame(ReqID(i), time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): i})
+		conn.Write(bd)
+	}
+	for i := 1; i <= count; i++ {
+		bd, _ := packer.PackFrame(ReqID(100+i), time.Now(), OperationCode(3), CommandCode(1), ReqData{DataCode(0): i})
+		conn.Write(bd)
+	}
+
+	for i := 0; i < count*2; i++ {
+		readTestResponse(t, conn, packer)
+	}
+
+	ordered.Lock()
+	defer ordered.Unlock()
+	if ordered.maxRunning != 1 {
+		t.Errorf("ordered operation run concurrently. max = %v", ordered.maxRunning)
+	}
+	for i, seq := range ordered.order {
+		if seq != int64(i+1) {
+			t.Fatalf("ordered operation out of order. %v", ordered.order)
+		}
+	}
+
+	unordered.Lock()
+	defer unordered.Unlock()
+	if unordered.maxRunning <= 1 {
+		t.Errorf("unordered operation not run concurrently. max = %v", unordered.maxRunning)
+	}
+}
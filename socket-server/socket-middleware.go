@@ -0,0 +1,107 @@
+package socketserver
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+)
+
+// 流程處理函式
+type HandlerFunc func(context.Context, *SocketRequest) error
+
+// 中介層，包住下一層處理函式，不呼叫 next 即可中斷流程
+type Middleware func(next HandlerFunc) HandlerFunc
+
+type commandKey struct {
+	opCode  OperationCode
+	cmdCode CommandCode
+}
+
+// 加入所有流程共用的中介層，需在伺服器啟動前設定
+func (server *SocketServer) Use(middlewares ...Middleware) {
+	server.middlewares = append(server.middlewares, middlewares...)
+}
+
+// 加入指定流程的中介層，需在伺服器啟動前設定
+func (server *SocketServer) UseOperation(opCode OperationCode, middlewares ...Middleware) {
+	server.opMiddlewares[opCode] = append(server.opMiddlewares[opCode], middlewares...)
+}
+
+// 加入指定流程指令的中介層，需在伺服器啟動前設定
+func (server *SocketServer) UseCommand(opCode OperationCode, cmdCode CommandCode, middlewares ...Middleware) {
+	key := commandKey{opCode: opCode, cmdCode: cmdCode}
+	server.cmdMiddlewares[key] = append(server.cmdMiddlewares[key], middlewares...)
+}
+
+// 組合中介層，依序為共用、流程、指令，最內層為流程器
+func (server *SocketServer) buildHandler(op IOperation, opCode OperationCode, cmdCode CommandCode) HandlerFunc {
+	var handler HandlerFunc = op.Command
+
+	chain := make([]Middleware, 0, len(server.middlewares))
+	chain = append(chain, server.middlewares...)
+	chain = append(chain, server.opMiddlewares[opCode]...)
+	chain = append(chain, server.cmdMiddlewares[commandKey{opCode: opCode, cmdCode: cmdCode}]...)
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+
+	return handler
+}
+
+// 攔截流程中的 panic，記錄堆疊並回覆內部錯誤，panic 轉為 ErrOperationPanic 交給外層的中介層；
+// 未使用時仍由 RunOperation 攔截並回覆內部錯誤，但外層的中介層會隨 panic 中斷
+func Recovery(log *logger.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *SocketRequest) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v", ErrOperationPanic, r)
+					log.Error(fmt.Sprintf("Recover!! Operation panic. Op code = %v, Cmd code = %v, error message => %v\n%s", req.OperationCode(), req.CommandCode(), r, debug.Stack()))
+					req.ResponseError(ErrorCodeInternal, "internal error")
+				}
+			}()
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// 記錄每個請求的客戶端、流程、執行時間與結果
+func AccessLog(log *logger.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *SocketRequest) error {
+			startTime := time.Now()
+			err := next(ctx, req)
+
+			clientID := ""
+			if req.client != nil {
+				clientID = req.client.ID()
+			}
+
+			if err != nil {
+				log.Info(fmt.Sprintf("Access. client = %v, Op code = %v, Cmd code = %v, req id = %v, cost = %v, error = %v", clientID, req.OperationCode(), req.CommandCode(), req.GetID(), time.Since(startTime), err.Error()))
+			} else {
+				log.Info(fmt.Sprintf("Access. client = %v, Op code = %v, Cmd code = %v, req id = %v, cost = %v", clientID, req.OperationCode(), req.CommandCode(), req.GetID(), time.Since(startTime)))
+			}
+
+			return err
+		}
+	}
+}
+
+// 量測執行時間並交給 observe 記錄，例如寫入監控指標
+func Timing(observe func(opCode OperationCode, cmdCode CommandCode, cost time.Duration, err error)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *SocketRequest) error {
+			startTime := time.Now()
+			err := next(ctx, req)
+
+			observe(req.OperationCode(), req.CommandCode(), time.Since(startTime), err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package socketserver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 記錄中介層執行順序的流程器
+type traceOperation struct {
+	echoOperation
+	sync.Mutex
+
+	trace []string
+}
+
+func (op *traceOperation) add(name string) {
+	op.Lock()
+	defer op.Unlock()
+
+	op.trace = append(op.trace, name)
+}
+
+func (op *traceOperation) Command(ctx context.Context, req *SocketRequest) error {
+	if req.CommandCode() == CommandCode(7) {
+		panic("boom")
+	}
+
+	op.add("handler")
+	return req.Response(req.reqData)
+}
+
+func (op *traceOperation) middleware(name string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *SocketRequest) error {
+			op.add(name)
+			return next(ctx, req)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	op := &traceOperation{echoOperation: echoOperation{opCode: OperationCode(2)}}
+	server.AddOperation(op)
+
+	timing := make(chan time.Duration, 4)
+	server.Use(Recovery(server.logger), Timing(func(opCode OperationCode, cmdCode CommandCode, cost time.Duration, err error) {
+		timing <- cost
+	}))
+	server.Use(op.middleware("global"))
+	server.UseOperation(OperationCode(2), op.middleware("operation"))
+	server.UseCommand(OperationCode(2), CommandCode(1), op.middleware("command"))
+
+	// 指定指令直接以錯誤回覆，不進入流程器
+	server.UseCommand(OperationCode(2), CommandCode(9), func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, req *SocketRequest) error {
+			return req.ResponseError(ErrorCode(100), "denied")
+		}
+	})
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packer := NewPacket(nil)
+	call := func(cmdCode CommandCode) *SocketRequest {
+		bd, _ := packer.PackFrame(1, time.Now(), OperationCode(2), cmdCode, ReqData{})
+		conn.Write(bd)
+		return readTestResponse(t, conn, packer)
+	}
+
+	if res := call(CommandCode(1)); res.OperationCode() != OperationCode(2) {
+		t.Fatalf("response mismatch. %+v", res)
+	}
+
+	op.Lock()
+	expect := []string{"global", "operation", "command", "handler"}
+	if len(op.trace) != len(expect) {
+		t.Fatalf("middleware order mismatch. %v", op.trace)
+	}
+	for i := range expect {
+		if op.trace[i] != expect[i] {
+			t.Fatalf("middleware order mismatch. %v", op.trace)
+		}
+	}
+	op.trace = nil
+	op.Unlock()
+
+	res := call(CommandCode(9))
+	if code, _ := res.GetInt64(DataCodeErrorCode); res.CommandCode() != CmdError || ErrorCode(code) != ErrorCode(100) {
+		t.Fatalf("short circuit response mismatch. %+v", res)
+	}
+
+	res = call(CommandCode(7))
+	if code, _ := res.GetInt64(DataCodeErrorCode); res.CommandCode() != CmdError || ErrorCode(code) != ErrorCodeInternal {
+		t.Fatalf("recovery response mismatch. %+v", res)
+	}
+
+	op.Lock()
+	for _, name := range op.trace {
+		if name == "handler" {
+			t.Fatalf("handler should not run. %v", op.trace)
+		}
+	}
+	op.Unlock()
+
+	// panic 時 Timing 內層中斷，只記錄前兩個請求
+	if len(timing) != 2 {
+		t.Fatalf("timing count mismatch. %v", len(timing))
+	}
+}
+
+func TestOperationPanicWithoutRecovery(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	op := &traceOperation{echoOperation: echoOperation{opCode: OperationCode(2)}}
+	server.AddOperation(op)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 未使用 Recovery 時流程 panic 仍回覆內部錯誤，伺服器繼續運作
+	packer := NewPacket(nil)
+	bd, _ := packer.PackFrame(1, time.Now(), OperationCode(2), CommandCode(7), ReqData{})
+	conn.Write(bd)
+
+	res := readTestResponse(t, conn, packer)
+	if code, _ := res.GetInt64(DataCodeErrorCode); res.CommandCode() != CmdError || ErrorCode(code) != ErrorCodeInternal {
+		t.Fatalf("panic response mismatch. %+v", res)
+	}
+
+	bd, _ = packer.PackFrame(2, time.Now(), OperationCode(2), CommandCode(1), ReqData{})
+	conn.Write(bd)
+	if res := readTestResponse(t, conn, packer); res.GetID() != 2 || res.OperationCode() != OperationCode(2) {
+		t.Fatalf("response after panic mismatch. %+v", res)
+	}
+}
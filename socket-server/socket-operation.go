@@ -1,19 +1,94 @@
 package socketserver
 
-import "github.com/andy2kuo/AndyGameServerGo/logger"
+import (
+	"context"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+)
 
 type OperationEventCode byte
 
 // 流程器
 type IOperation interface {
 	GetOperationCode() OperationCode
-	Command(*SocketRequest) error
+	Command(context.Context, *SocketRequest) error // context 在超時、客戶端斷線或伺服器關閉時取消
 	OnOperationInit(*SocketServer, *logger.Logger) error
 	OnClientConnect(*SocketClient) error
-	OnClientDisconnect(*SocketClient) error
+	OnClientAuthenticated(*SocketClient) error
+	OnClientDisconnect(*SocketClient) error // 斷線原因可由 SocketClient.DisconnectReason 取得
+	OnClientResume(*SocketClient) error     // 客戶端在保留期間內重新連線，不會另外發出斷線與連線事件
 	OnEventNotify(*SocketClient, OperationEvent) error
 	OnServerStart() error
 	OnServerClose() error
+	OnRoomCreate(*Room) error
+	OnRoomDestroy(*Room) error // 房間刪除時成員一併移出，不會另外發出離開事件
+	OnRoomJoin(*Room, *SocketClient) error
+	OnRoomLeave(*Room, *SocketClient) error
+}
+
+// 流程器基底，提供事件的預設實作，流程器只需實作 GetOperationCode、Command 與需要的事件
+type BaseOperation struct {
+	server *SocketServer
+	logger *logger.Logger
+}
+
+func (b *BaseOperation) OnOperationInit(_server *SocketServer, _logger *logger.Logger) error {
+	b.server = _server
+	b.logger = _logger
+
+	return nil
+}
+
+func (b *BaseOperation) Server() *SocketServer {
+	return b.server
+}
+
+func (b *BaseOperation) Logger() *logger.Logger {
+	return b.logger
+}
+
+func (b *BaseOperation) OnClientConnect(*SocketClient) error {
+	return nil
+}
+
+func (b *BaseOperation) OnClientAuthenticated(*SocketClient) error {
+	return nil
+}
+
+func (b *BaseOperation) OnClientDisconnect(*SocketClient) error {
+	return nil
+}
+
+func (b *BaseOperation) OnClientResume(*SocketClient) error {
+	return nil
+}
+
+func (b *BaseOperation) OnEventNotify(*SocketClient, OperationEvent) error {
+	return nil
+}
+
+func (b *BaseOperation) OnServerStart() error {
+	return nil
+}
+
+func (b *BaseOperation) OnServerClose() error {
+	return nil
+}
+
+func (b *BaseOperation) OnRoomCreate(*Room) error {
+	return nil
+}
+
+func (b *BaseOperation) OnRoomDestroy(*Room) error {
+	return nil
+}
+
+func (b *BaseOperation) OnRoomJoin(*Room, *SocketClient) error {
+	return nil
+}
+
+func (b *BaseOperation) OnRoomLeave(*Room, *SocketClient) error {
+	return nil
 }
 
 // 產生新的流程事件
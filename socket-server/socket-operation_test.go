@@ -0,0 +1,94 @@
+package socketserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// 等待 context 結束並回報原因的流程器
+type blockOperation struct {
+	echoOperation
+	result chan error
+}
+
+func (op *blockOperation) Command(ctx context.Context, req *SocketRequest) error {
+	<-ctx.Done()
+
+	if req.Context() != ctx {
+		op.result <- errors.New("request context mismatch")
+		return nil
+	}
+
+	op.result <- ctx.Err()
+	return nil
+}
+
+func TestOperationContext(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	timeoutOp := &blockOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, result: make(chan error, 1)}
+	disconnectOp := &blockOperation{echoOperation: echoOperation{opCode: OperationCode(3)}, result: make(chan error, 1)}
+	server.AddOperation(timeoutOp)
+	server.AddOperation(disconnectOp)
+	server.SetOperationTimeout(OperationCode(2), time.Millisecond*100)
+	server.SetUnorderedOperation(OperationCode(3), true)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packer := NewPacket(nil)
+	send := func(opCode OperationCode) {
+		bd, _ := packer.PackFrame(1, time.Now(), opCode, CommandCode(1), ReqData{})
+		conn.Write(bd)
+	}
+
+	wait := func(op *blockOperation) error {
+		select {
+		case err := <-op.result:
+			return err
+		case <-time.After(time.Second * 3):
+			t.Fatal("operation context not cancelled")
+			return nil
+		}
+	}
+
+	// 超過個別設定的時間上限
+	send(OperationCode(2))
+	if err := wait(timeoutOp); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("timeout context error mismatch. %v", err)
+	}
+
+	// 客戶端斷線時取消
+	send(OperationCode(3))
+	time.Sleep(time.Millisecond * 50)
+	conn.Close()
+	if err := wait(disconnectOp); !errors.Is(err, context.Canceled) {
+		t.Fatalf("disconnect context error mismatch. %v", err)
+	}
+}
+
+func TestOperationTimeoutWait(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	// 不理會 ctx 的流程，超時後仍需等待流程結束才釋放
+	op := &slowOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, delay: time.Millisecond * 300}
+	server.AddOperation(op)
+	server.SetOperationTimeout(OperationCode(2), time.Millisecond*50)
+
+	server.RunOperation(NewSocketRequest(OperationCode(2), CommandCode(1)))
+
+	op.Lock()
+	defer op.Unlock()
+	if op.finishTime.IsZero() {
+		t.Fatal("run operation returned before handler finished")
+	}
+}
@@ -3,12 +3,17 @@ package socketserver
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"sync"
 	"time"
 )
 
+// 封包長度欄位後的最小長度: 標記 1 + 請求編號 4 + 時間 8 + 流程 1 + 指令 1
+const frameMinLength = 1 + 4 + 8 + 1 + 1
+
+// 未指定客戶端時的預設封包大小上限
+const DefaultMaxFrameSize = 1024 * 1024
+
 func NewPacket(client *SocketClient) (p *Packer) {
 	p = &Packer{
 		buffer:        make([]byte, 0),
@@ -16,6 +21,20 @@ func NewPacket(client *SocketClient) (p *Packer) {
 		nowDataLength: 0,
 		nowIndex:      0,
 		maxIndex:      0,
+		codec:         JSONCodec{},
+		maxFrameSize:  DefaultMaxFrameSize,
+	}
+
+	if client != nil && client.server != nil {
+		if client.server.codec != nil {
+			p.codec = client.server.codec
+		}
+
+		setting := client.server.AppSetting.Server
+		p.compressFlag, _ = compressionFlag(setting.Compression)
+		p.compressThreshold = setting.CompressThreshold
+		p.maxDecompressSize = setting.MaxDecompressSize
+		p.maxFrameSize = setting.MaxFrameSize
 	}
 
 	return p
@@ -31,6 +50,82 @@ type Packer struct {
 
 	nowIndex uint8
 	maxIndex uint8
+
+	codec       ICodec                      // 請求資料編碼器
+	codecSwitch func(*SocketRequest) ICodec // 解析出封包後決定是否切換編碼，切換後移除
+
+	compressFlag      byte // 發送封包使用的壓縮方式，0 為不壓縮
+	compressThreshold int  // 封包內容超過此大小才壓縮
+	maxDecompressSize int  // 解壓縮後的大小上限，0 為不限制
+
+	cipher *FrameCipher // 封包加密器，未加密時為 nil
+
+	maxFrameSize   int  // 封包大小上限，0 為不限制
+	malformedCount int  // 累計的錯誤封包數量
+	broken         bool // 封包長度錯誤，資料流已無法解析
+}
+
+// 設定封包大小上限
+func (p *Packer) SetMaxFrameSize(size int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.maxFrameSize = size
+}
+
+// 設定封包加密器，之後收發的封包皆會加密
+func (p *Packer) SetCipher(frameCipher *FrameCipher) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.cipher = frameCipher
+}
+
+// 設定發送封包的壓縮方式與門檻
+func (p *Packer) SetCompression(name string, threshold int) error {
+	flag, err := compressionFlag(name)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.compressFlag = flag
+	p.compressThreshold = threshold
+	return nil
+}
+
+// 設定解壓縮後的大小上限
+func (p *Packer) SetMaxDecompressSize(size int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.maxDecompressSize = size
+}
+
+// 設定請求資料編碼器
+func (p *Packer) SetCodec(codec ICodec) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.codec = codec
+}
+
+// 設定編碼切換判斷，每解析出一個封包即呼叫，回傳編碼器時立即切換，同一批資料中之後的封包以新的編碼解析
+func (p *Packer) SetCodecSwitch(codecSwitch func(*SocketRequest) ICodec) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.codecSwitch = codecSwitch
+}
+
+// 取得請求資料編碼器
+func (p *Packer) Codec() ICodec {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.codec
 }
 
 func (p *Packer) Done() bool {
@@ -41,8 +136,8 @@ func (p *Packer) Done() bool {
 }
 
 func (p *Packer) GetWithClient(client *SocketClient) (req *SocketRequest) {
-	p.RLock()
-	defer p.RUnlock()
+	p.Lock()
+	defer p.Unlock()
 
 	if len(p.tempRequests) > 0 {
 		req = p.tempRequests[p.nowIndex]
@@ -55,8 +150,8 @@ func (p *Packer) GetWithClient(client *SocketClient) (req *SocketRequest) {
 }
 
 func (p *Packer) Get() (req *SocketRequest) {
-	p.RLock()
-	defer p.RUnlock()
+	p.Lock()
+	defer p.Unlock()
 
 	if len(p.tempRequests) > 0 {
 		req = p.tempRequests[p.nowIndex]
@@ -80,35 +175,63 @@ func (p *Packer) Add(data []byte) (err error) {
 		return err
 	}
 
+	// 長度錯誤後無法再找到下一個封包的起點，之後的資料全部捨棄
+	if p.broken {
+		return &FrameError{Reason: "stream broken by previous invalid header", Fatal: true, Err: ErrFrameMalformed}
+	}
+
 	p.buffer = append(p.buffer, data...)
 
 	for {
 		if p.nowDataLength <= 0 {
-			if len(p.buffer) >= 4 {
-				err := binary.Read(bytes.NewBuffer(p.buffer[0:4]), binary.LittleEndian, &p.nowDataLength)
-				if err != nil {
-					return err
-				}
-			} else {
+			if len(p.buffer) < 4 {
 				break
 			}
+
+			p.nowDataLength = int32(binary.LittleEndian.Uint32(p.buffer[0:4]))
+			if frameErr := p.checkLength(p.nowDataLength); frameErr != nil {
+				p.malformedCount++
+				p.broken = true
+				p.buffer = nil
+				p.nowDataLength = 0
+				return frameErr
+			}
 		}
 
-		if p.nowDataLength > 0 {
-			if len(p.buffer) >= int(p.nowDataLength) {
-				packet_data := p.buffer[4 : p.nowDataLength+4]
+		if len(p.buffer) < int(p.nowDataLength)+4 {
+			break
+		}
 
-				err = p.transferData(packet_data)
+		packet_data := p.buffer[4 : p.nowDataLength+4]
 
-				p.buffer = p.buffer[p.nowDataLength+4:]
-				p.nowDataLength = 0
+		var frameErr error
+		if p.cipher != nil {
+			packet_data, frameErr = p.cipher.Open(packet_data, p.buffer[0:4])
+			if frameErr != nil {
+				// 加密狀態已無法同步，必須中斷連線
+				frameErr = &FrameError{Reason: "frame authentication fail", Length: p.nowDataLength, Fatal: true, Err: frameErr}
+			}
+		}
 
-				if err != nil {
-					err = fmt.Errorf("socket client transfer data fail. Error => %v", err)
-					return err
-				}
-			} else {
-				break
+		if frameErr == nil {
+			frameErr = p.transferData(packet_data)
+		}
+
+		p.buffer = p.buffer[p.nowDataLength+4:]
+		p.nowDataLength = 0
+
+		// 單一封包錯誤只略過此封包，繼續處理後續封包
+		if frameErr != nil {
+			p.malformedCount++
+			if err == nil {
+				err = frameErr
+			}
+
+			var fe *FrameError
+			if errors.As(frameErr, &fe) && fe.Fatal {
+				p.broken = true
+				p.buffer = nil
+				return err
 			}
 		}
 	}
@@ -116,40 +239,96 @@ func (p *Packer) Add(data []byte) (err error) {
 	return err
 }
 
+// 檢查封包長度
+func (p *Packer) checkLength(length int32) error {
+	minLength := int32(frameMinLength)
+	if p.cipher != nil {
+		minLength += int32(p.cipher.Overhead())
+	}
+
+	if length < minLength {
+		return &FrameError{Reason: "frame length too small", Length: length, Fatal: true, Err: ErrFrameTooSmall}
+	}
+
+	if p.maxFrameSize > 0 && int(length) > p.maxFrameSize {
+		return &FrameError{Reason: "frame length over limit", Length: length, Fatal: true, Err: ErrFrameTooLarge}
+	}
+
+	return nil
+}
+
+// 取得累計的錯誤封包數量
+func (p *Packer) MalformedCount() int {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.malformedCount
+}
+
 func (p *Packer) transferData(data []byte) (err error) {
 	err = nil
+	length := int32(len(data))
+
+	// 封包標記
+	if len(data) < 1 {
+		return &FrameError{Reason: "invalid flags", Length: length, Err: ErrFrameMalformed}
+	}
+
+	data, err = decompressFrame(data[0], data[1:], p.maxDecompressSize)
+	if err != nil {
+		return &FrameError{Reason: "decompress fail", Length: length, Err: err}
+	}
 
 	data_buff := bytes.NewBuffer(data)
 
+	// Request ID
+	var reqID ReqID
+	bd_reqID := data_buff.Next(4)
+	if len(bd_reqID) < 4 {
+		return &FrameError{Reason: "invalid request id", Length: length, Err: ErrFrameMalformed}
+	}
+	binary.Read(bytes.NewBuffer(bd_reqID), binary.LittleEndian, &reqID)
+
 	var uid ReqUID
 	bd_uid := data_buff.Next(8)
 	if len(bd_uid) < 8 {
-		return fmt.Errorf("request unpack fail. invalid uid")
+		return &FrameError{Reason: "invalid uid", Length: length, Err: ErrFrameMalformed}
 	}
 	binary.Read(bytes.NewBuffer(bd_uid), binary.LittleEndian, &uid)
 
 	// Operation Code
 	var opCode OperationCode
 	bd_opCode := data_buff.Next(1)
-	if len(bd_uid) < 1 {
-		return fmt.Errorf("request unpack fail. invalid op code")
+	if len(bd_opCode) < 1 {
+		return &FrameError{Reason: "invalid op code", Length: length, Err: ErrFrameMalformed}
 	}
 	binary.Read(bytes.NewBuffer(bd_opCode), binary.LittleEndian, &opCode)
 
 	// Comand Code
 	var cmdCode CommandCode
 	bd_cmdCode := data_buff.Next(1)
-	if len(bd_uid) < 1 {
-		return fmt.Errorf("request unpack fail. invalid command code")
+	if len(bd_cmdCode) < 1 {
+		return &FrameError{Reason: "invalid command code", Length: length, Err: ErrFrameMalformed}
 	}
 	binary.Read(bytes.NewBuffer(bd_cmdCode), binary.LittleEndian, &cmdCode)
 
-	var reqData ReqData
-	err = json.Unmarshal(data_buff.Next(data_buff.Len()), &reqData)
+	reqData, err := p.codec.Unmarshal(data_buff.Next(data_buff.Len()))
+	if err != nil {
+		return &FrameError{Reason: "decode request data fail", Length: length, Err: err}
+	}
 
 	req := NewSocketRequest(opCode, cmdCode)
 	req.uid = uid
+	req.id = reqID
 	req.SetAll(reqData)
+
+	if p.codecSwitch != nil {
+		if codec := p.codecSwitch(req); codec != nil {
+			p.codec = codec
+			p.codecSwitch = nil
+		}
+	}
+
 	p.tempRequests[p.maxIndex] = req
 	if p.maxIndex < 255 {
 		p.maxIndex++
@@ -157,32 +336,114 @@ func (p *Packer) transferData(data []byte) (err error) {
 		p.maxIndex = 0
 	}
 
-	return err
+	return nil
 }
 
-// 打包檔案
+// 打包檔案，請求編號為 0
 func (p *Packer) PackData(reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) (byteData []byte, err error) {
-	byteData = make([]byte, 0)
-	err = nil
+	return p.PackFrame(0, reqTime, opCode, cmdCode, reqData)
+}
 
-	var jsonData []byte
-	jsonData, err = json.Marshal(reqData)
+// 打包檔案，並帶入請求編號以便對應回覆
+func (p *Packer) PackFrame(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) (byteData []byte, err error) {
+	plain, err := p.encodeFrame(reqID, reqTime, opCode, cmdCode, reqData)
 	if err != nil {
-		return byteData, err
+		return make([]byte, 0), err
+	}
+
+	return p.sealFrame(plain), nil
+}
+
+// 封包內容的編碼設定，設定相同時編碼結果相同
+type frameEncoding struct {
+	codec             ICodec
+	compressFlag      byte
+	compressThreshold int
+}
+
+// 編碼設定的比對鍵值，不壓縮時忽略門檻
+type frameEncodingKey struct {
+	codec             string
+	compressFlag      byte
+	compressThreshold int
+}
+
+func (encoding frameEncoding) key() frameEncodingKey {
+	key := frameEncodingKey{codec: encoding.codec.Name(), compressFlag: encoding.compressFlag}
+	if encoding.compressFlag != 0 {
+		key.compressThreshold = encoding.compressThreshold
 	}
 
-	var totalLength int32 = int32(8 + 1 + 1 + len(jsonData))
+	return key
+}
+
+// 取得目前的編碼設定
+func (p *Packer) frameEncoding() frameEncoding {
+	p.RLock()
+	defer p.RUnlock()
+
+	return frameEncoding{codec: p.codec, compressFlag: p.compressFlag, compressThreshold: p.compressThreshold}
+}
+
+// 編碼封包內容 (標記 + 內容)，不含長度欄位且尚未加密
+func (p *Packer) encodeFrame(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) ([]byte, error) {
+	return p.frameEncoding().encode(reqID, reqTime, opCode, cmdCode, reqData)
+}
 
-	buf := bytes.NewBuffer(make([]byte, 0))
+// 以此編碼設定編碼封包內容，相同編碼設定的客戶端可共用
+func (encoding frameEncoding) encode(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) ([]byte, error) {
+	codec, compressFlag, compressThreshold := encoding.codec, encoding.compressFlag, encoding.compressThreshold
+
+	encodeData, err := codec.Marshal(reqData)
+	if err != nil {
+		return nil, err
+	}
+
+	body := bytes.NewBuffer(make([]byte, 0, 4+8+1+1+len(encodeData)))
+	binary.Write(body, binary.LittleEndian, reqID)
+	binary.Write(body, binary.LittleEndian, reqTime.UnixMilli())
+	binary.Write(body, binary.LittleEndian, opCode)
+	binary.Write(body, binary.LittleEndian, cmdCode)
+	body.Write(encodeData)
+
+	// 超過門檻才壓縮，且壓縮後必須較小才使用
+	var flags byte = 0
+	bodyData := body.Bytes()
+	if compressFlag != 0 && len(bodyData) >= compressThreshold {
+		compressed := compressFrame(compressFlag, bodyData)
+		if len(compressed) < len(bodyData) {
+			flags |= compressFlag
+			bodyData = compressed
+		}
+	}
+
+	return append([]byte{flags}, bodyData...), nil
+}
+
+// 加上長度欄位，設定加密器時一併加密
+func (p *Packer) sealFrame(plain []byte) []byte {
+	p.RLock()
+	frameCipher := p.cipher
+	p.RUnlock()
+
+	var totalLength int32 = int32(len(plain))
+	if frameCipher != nil {
+		totalLength += int32(frameCipher.Overhead())
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, 4+totalLength))
 	binary.Write(buf, binary.LittleEndian, totalLength)
-	binary.Write(buf, binary.LittleEndian, reqTime.UnixMilli())
-	binary.Write(buf, binary.LittleEndian, opCode)
-	binary.Write(buf, binary.LittleEndian, cmdCode)
-	binary.Write(buf, binary.LittleEndian, jsonData)
 
-	return buf.Bytes(), err
+	if frameCipher != nil {
+		// 長度欄位不加密，但列入驗證
+		buf.Write(frameCipher.Seal(plain, buf.Bytes()))
+	} else {
+		buf.Write(plain)
+	}
+
+	return buf.Bytes()
 }
 
 func (p *Packer) PackRequest(req *SocketRequest) ([]byte, error) {
-	return p.PackData(req.GetRequestTime(), req.opCode, req.cmdCode, req.reqData)
+	return p.PackFrame(req.id, req.GetRequestTime(), req.opCode, req.cmdCode, req.reqData)
 }
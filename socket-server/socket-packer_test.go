@@ -1,7 +1,12 @@
 package socketserver
 
 import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPack(t *testing.T) {
@@ -33,3 +38,212 @@ func TestPack(t *testing.T) {
 		t.Error("Unpack fail")
 	}
 }
+
+func TestPackCodec(t *testing.T) {
+	for _, name := range []string{CodecJSON, CodecMsgPack, CodecProtobuf} {
+		codec, err := GetCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := NewSocketRequest(OperationCode(3), CommandCode(4))
+		req.SetAll(ReqData{
+			DataCode(0): "abc",
+			DataCode(1): 12345,
+			DataCode(2): 1.5,
+			DataCode(3): []interface{}{"x", 2},
+			DataCode(4): map[string]interface{}{"k": true},
+		})
+
+		packer := NewPacket(nil)
+		packer.SetCodec(codec)
+		bd, err := packer.PackRequest(req)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		t.Log(name, len(bd))
+
+		if err := packer.Add(bd); err != nil {
+			t.Fatal(name, err)
+		}
+
+		_req := packer.Get()
+		if str, _ := _req.GetString(DataCode(0)); str != "abc" {
+			t.Error(name, "string mismatch", str)
+		}
+		if num, _ := _req.GetInt64(DataCode(1)); num != 12345 {
+			t.Error(name, "int mismatch", num)
+		}
+		if num, _ := _req.GetFloat64(DataCode(2)); num != 1.5 {
+			t.Error(name, "float mismatch", num)
+		}
+
+		if name != CodecJSON {
+			if data, _ := _req.Get(DataCode(1)); data != int64(12345) {
+				t.Errorf("%v int type mismatch %T", name, data)
+			}
+		}
+
+		list, _ := _req.Get(DataCode(3))
+		if items, isList := list.([]interface{}); !isList || len(items) != 2 || items[0] != "x" {
+			t.Error(name, "list mismatch", list)
+		}
+
+		dict, _ := _req.Get(DataCode(4))
+		if fields, isMap := dict.(map[string]interface{}); !isMap || fields["k"] != true {
+			t.Error(name, "map mismatch", dict)
+		}
+	}
+}
+
+func TestPackCodecSwitch(t *testing.T) {
+	msgpackCodec, _ := GetCodec(CodecMsgPack)
+
+	// 切換前的回覆以 json 編碼，之後的推送以 msgpack 編碼，兩者在同一次讀取中收到
+	jsonPacker := NewPacket(nil)
+	msgpackPacker := NewPacket(nil)
+	msgpackPacker.SetCodec(msgpackCodec)
+
+	reply, _ := jsonPacker.PackFrame(1, time.Now(), OpCodeSystem, CmdHello, ReqData{DataCodeCodec: CodecMsgPack})
+	push, _ := msgpackPacker.PackData(time.Now(), OperationCode(1), CommandCode(3), ReqData{DataCode(0): 7})
+
+	packer := NewPacket(nil)
+	packer.SetCodecSwitch(func(req *SocketRequest) ICodec {
+		if req.CommandCode() != CmdHello {
+			return nil
+		}
+		return msgpackCodec
+	})
+
+	if err := packer.Add(append(reply, push...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := packer.Get(); res.CommandCode() != CmdHello {
+		t.Fatalf("reply mismatch. %+v", res)
+	}
+
+	res := packer.Get()
+	if data, _ := res.Get(DataCode(0)); data != int64(7) {
+		t.Fatalf("push after switch mismatch. %v(%T)", data, data)
+	}
+
+	if packer.Codec().Name() != CodecMsgPack {
+		t.Fatalf("codec not switched. %v", packer.Codec().Name())
+	}
+}
+
+func TestPackCompression(t *testing.T) {
+	largeData := strings.Repeat("inventory-item;", 500)
+
+	for _, name := range []string{CompressionSnappy, CompressionZstd} {
+		req := NewSocketRequest(OperationCode(5), CommandCode(6))
+		req.Set(DataCode(0), largeData)
+
+		packer := NewPacket(nil)
+		if err := packer.SetCompression(name, 1024); err != nil {
+			t.Fatal(err)
+		}
+
+		bd, err := packer.PackRequest(req)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		if bd[4]&frameFlagCompressMask == 0 || len(bd) >= len(largeData) {
+			t.Errorf("%v frame not compressed. flags = %v, size = %v", name, bd[4], len(bd))
+		}
+
+		if err := packer.Add(bd); err != nil {
+			t.Fatal(name, err)
+		}
+
+		if data, _ := packer.Get().GetString(DataCode(0)); data != largeData {
+			t.Error(name, "decompress data mismatch")
+		}
+
+		// 解壓縮大小超過上限
+		packer.SetMaxDecompressSize(1024)
+		err = packer.Add(bd)
+		if !errors.Is(err, ErrDecompressOverflow) {
+			t.Errorf("%v decompress limit not work. %v", name, err)
+		}
+	}
+}
+
+func TestZstdWindowLimit(t *testing.T) {
+	maxSize := 4 << 20
+
+	// 宣告 512 MB 視窗 (window descriptor 0x98) 的 zstd 封包，只含一個空白區塊
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x98, 0x01, 0x00, 0x00}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := decompressFrame(FrameFlagZstd, frame, maxSize)
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, ErrDecompressOverflow) {
+		t.Fatalf("oversized window not rejected. %v", err)
+	}
+
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > uint64(maxSize)*4 {
+		t.Fatalf("decoder allocated %v bytes for oversized window", alloc)
+	}
+
+	// 上限內超過 1 MB 的內容仍可解壓
+	data := []byte(strings.Repeat("snapshot;", 300000))
+	decoded, err := decompressFrame(FrameFlagZstd, compressFrame(FrameFlagZstd, data), maxSize)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("decompress within limit fail. %v", err)
+	}
+}
+
+func TestPackFrameValidation(t *testing.T) {
+	req := NewSocketRequest(OperationCode(1), CommandCode(2))
+	req.Set(DataCode(0), "ok")
+
+	// 逐位元組送入，不可提早解析
+	packer := NewPacket(nil)
+	bd, _ := packer.PackRequest(req)
+	for i := range bd {
+		if err := packer.Add(bd[i : i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !packer.Done() {
+		t.Error("fragmented frame not unpacked")
+	}
+
+	// 負數長度
+	packer = NewPacket(nil)
+	err := packer.Add([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0})
+	if !errors.Is(err, ErrFrameTooSmall) {
+		t.Errorf("negative length not rejected. %v", err)
+	}
+	if err := packer.Add(bd); !errors.Is(err, ErrFrameMalformed) {
+		t.Errorf("broken stream still accepted. %v", err)
+	}
+
+	// 超過大小上限
+	packer = NewPacket(nil)
+	packer.SetMaxFrameSize(8)
+	if err := packer.Add(bd); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("large frame not rejected. %v", err)
+	}
+
+	// 資料內容錯誤只略過該封包
+	packer = NewPacket(nil)
+	bad := append([]byte{}, bd...)
+	bad[len(bad)-1] = '#'
+	err = packer.Add(append(bad, bd...))
+	var frameErr *FrameError
+	if !errors.As(err, &frameErr) || frameErr.Fatal {
+		t.Errorf("malformed payload error mismatch. %v", err)
+	}
+	if packer.MalformedCount() != 1 {
+		t.Errorf("malformed count mismatch. %v", packer.MalformedCount())
+	}
+	if data, _ := packer.Get().GetString(DataCode(0)); data != "ok" {
+		t.Error("valid frame after malformed frame not unpacked")
+	}
+}
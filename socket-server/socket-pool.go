@@ -0,0 +1,103 @@
+package socketserver
+
+import (
+	"fmt"
+)
+
+// 佇列已滿時的處理方式
+const (
+	QueueFullPause      = "pause"
+	QueueFullReject     = "reject"
+	QueueFullDisconnect = "disconnect"
+)
+
+// 等待執行的流程
+type operationJob struct {
+	req  *SocketRequest
+	done chan struct{} // 執行完畢通知，不需等待時為 nil
+}
+
+// 確認佇列處理方式
+func checkQueueFull(policy string) error {
+	switch policy {
+	case QueueFullPause, QueueFullReject, QueueFullDisconnect:
+		return nil
+	default:
+		return fmt.Errorf("%w: %v", ErrQueueFullInvalid, policy)
+	}
+}
+
+// 啟動工作池
+func (server *SocketServer) startWorkers() {
+	setting := server.AppSetting.Operation
+	if setting.WorkerCount <= 0 {
+		return
+	}
+
+	server.jobs = make(chan operationJob, setting.QueueSize)
+	for i := 0; i < setting.WorkerCount; i++ {
+		go server.runWorker()
+	}
+}
+
+func (server *SocketServer) runWorker() {
+	for {
+		select {
+		case job := <-server.jobs:
+			server.RunOperation(job.req)
+			if job.done != nil {
+				close(job.done)
+			}
+		case <-server.ctx.Done():
+			return
+		}
+	}
+}
+
+// 取得等待執行的請求數量
+func (server *SocketServer) QueueDepth() int {
+	return len(server.jobs)
+}
+
+// 交給工作池執行，佇列已滿時依設定暫停、回覆忙碌或中斷連線，回傳是否已送入
+func (server *SocketServer) submit(client *SocketClient, req *SocketRequest, done chan struct{}) bool {
+	if server.jobs == nil {
+		go func() {
+			server.RunOperation(req)
+			if done != nil {
+				close(done)
+			}
+		}()
+		return true
+	}
+
+	job := operationJob{req: req, done: done}
+	select {
+	case server.jobs <- job:
+		return true
+	default:
+	}
+
+	switch server.AppSetting.Operation.QueueFull {
+	case QueueFullReject:
+		server.logger.Warn(fmt.Sprintf("Operation queue full, reject request. client = %v, Op code = %v, Cmd code = %v, depth = %v", client.ID(), req.OperationCode(), req.CommandCode(), server.QueueDepth()))
+		req.ResponseError(ErrorCodeBusy, "server busy")
+		client.finishPreAuth(req)
+		return false
+	case QueueFullDisconnect:
+		server.logger.Warn(fmt.Sprintf("Operation queue full, disconnect client. client = %v, depth = %v", client.ID(), server.QueueDepth()))
+		client.Close(ErrServerBusy)
+		client.finishPreAuth(req)
+		return false
+	default:
+		// 等待期間不再讀取此客戶端的封包
+		select {
+		case server.jobs <- job:
+			return true
+		case <-client.closed:
+			return false
+		case <-server.ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package socketserver
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func startPoolTest(t *testing.T, policy string) (*SocketServer, net.Conn) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Operation.WorkerCount = 1
+		setting.Operation.QueueSize = 1
+		setting.Operation.QueueFull = policy
+	})
+
+	op := &slowOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, delay: time.Millisecond * 300}
+	server.AddOperation(op)
+	server.SetUnorderedOperation(OperationCode(2), true)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一個執行中、一個在佇列中，其餘超出上限
+	packer := NewPacket(nil)
+	for id := ReqID(1); id <= 4; id++ {
+		bd, _ := packer.PackFrame(id, time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): int(id)})
+		conn.Write(bd)
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	return server, conn
+}
+
+func TestPoolReject(t *testing.T) {
+	server, conn := startPoolTest(t, QueueFullReject)
+	defer server.close()
+	defer conn.Close()
+
+	if depth := server.QueueDepth(); depth != 1 {
+		t.Errorf("queue depth mismatch. %v", depth)
+	}
+
+	packer := NewPacket(nil)
+	busy, done := 0, 0
+	for i := 0; i < 4; i++ {
+		res := readTestResponse(t, conn, packer)
+		if res.OperationCode() == OpCodeSystem && res.CommandCode() == CmdError {
+			if code, _ := res.GetInt64(DataCodeErrorCode); ErrorCode(code) != ErrorCodeBusy {
+				t.Fatalf("error code mismatch. %v", code)
+			}
+			busy++
+		} else {
+			done++
+		}
+	}
+
+	if busy != 2 || done != 2 {
+		t.Fatalf("reject count mismatch. busy = %v, done = %v", busy, done)
+	}
+}
+
+func TestPoolDisconnect(t *testing.T) {
+	server, conn := startPoolTest(t, QueueFullDisconnect)
+	defer server.close()
+	defer conn.Close()
+
+	clients := server.ClientRegistry.List()
+	for retry := 0; len(clients) > 0; retry++ {
+		if retry > 100 {
+			t.Fatal("client not disconnected")
+		}
+		time.Sleep(time.Millisecond * 20)
+		clients = server.ClientRegistry.List()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buffer := make([]byte, 1024)
+	for {
+		if _, err := conn.Read(buffer); err != nil {
+			break
+		}
+	}
+}
+
+func TestPoolPause(t *testing.T) {
+	server, conn := startPoolTest(t, QueueFullPause)
+	defer server.close()
+	defer conn.Close()
+
+	// 暫停讀取後所有請求仍會依序完成
+	packer := NewPacket(nil)
+	for i := 0; i < 4; i++ {
+		res := readTestResponse(t, conn, packer)
+		if res.OperationCode() == OpCodeSystem {
+			t.Fatalf("request should not be rejected. %+v", res)
+		}
+	}
+
+	if err := checkQueueFull("drop"); !errors.Is(err, ErrQueueFullInvalid) {
+		t.Fatalf("invalid policy should fail. %v", err)
+	}
+}
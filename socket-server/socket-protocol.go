@@ -0,0 +1,216 @@
+package socketserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 系統保留流程編號，此流程的請求由伺服器直接處理，不會進入 IOperation
+const OpCodeSystem OperationCode = 255
+
+// 系統指令
+const (
+	CmdHello         CommandCode = 1 // 版本協商
+	CmdResume        CommandCode = 2 // 恢復連線，未帶憑證時以新的連線狀態開始
+	CmdResumeToken   CommandCode = 3 // 伺服器發放恢復連線憑證
+	CmdKick          CommandCode = 4 // 伺服器通知客戶端被踢除，之後會關閉連線
+	CmdServerClosing CommandCode = 5 // 伺服器通知即將關閉
+	CmdError         CommandCode = 6 // 請求無法執行的錯誤回覆
+	CmdPing          CommandCode = 7 // 心跳，收到的一方需以相同請求編號回覆 CmdPong
+	CmdPong          CommandCode = 8 // 心跳回覆
+)
+
+// 版本協商資料編號
+const (
+	DataCodeProtocolVersion DataCode = 0 // 協定版本
+	DataCodeClientBuild     DataCode = 1 // 客戶端建置版本
+	DataCodePlatform        DataCode = 2 // 客戶端平台
+	DataCodeCodec           DataCode = 3 // 要求使用的請求資料編碼
+	DataCodeHelloResult     DataCode = 4 // 協商結果
+	DataCodeMessage         DataCode = 5 // 說明訊息
+	DataCodeUpgradeURL      DataCode = 6 // 強制更新網址
+	DataCodeResumeToken     DataCode = 7 // 恢復連線憑證
+	DataCodeResumeResult    DataCode = 8 // 恢復連線結果
+	DataCodeErrorCode       DataCode = 9 // 錯誤代碼
+
+	DataCodeRequestOperation DataCode = 10 // 發生錯誤的請求流程編號
+	DataCodeRequestCommand   DataCode = 11 // 發生錯誤的請求指令編號
+)
+
+type ErrorCode byte
+
+// 錯誤回覆代碼
+const (
+	ErrorCodeBusy            ErrorCode = 1 // 伺服器忙碌，請稍後再試
+	ErrorCodeInternal        ErrorCode = 2 // 流程執行發生內部錯誤
+	ErrorCodeRateLimited     ErrorCode = 3 // 請求過於頻繁
+	ErrorCodeUnauthenticated ErrorCode = 4 // 尚未登入
+)
+
+type HelloResult byte
+
+const (
+	HelloAccept       HelloResult = 0 // 允許連線
+	HelloReject       HelloResult = 1 // 拒絕連線
+	HelloForceUpgrade HelloResult = 2 // 需要更新客戶端
+)
+
+// 客戶端版本資訊
+type ClientVersion struct {
+	ProtocolVersion int
+	ClientBuild     int
+	Platform        string
+	Result          HelloResult
+}
+
+// 處理系統指令
+func (client *SocketClient) handleSystemRequest(req *SocketRequest) {
+	switch req.CommandCode() {
+	case CmdHello:
+		client.handleHello(req)
+	case CmdResume:
+		client.handleResume(req)
+	case CmdPing:
+		client.handlePing(req)
+	case CmdPong:
+		client.handlePong(req)
+	default:
+		client.logger.Warn(fmt.Sprintf("System command not exist. Cmd code = %v", req.CommandCode()))
+	}
+}
+
+// 處理版本協商
+func (client *SocketClient) handleHello(req *SocketRequest) {
+	setting := client.server.AppSetting.Protocol
+
+	protocolVersion, _ := req.GetInt64(DataCodeProtocolVersion)
+	clientBuild, _ := req.GetInt64(DataCodeClientBuild)
+	platform, _ := req.GetString(DataCodePlatform)
+
+	version := ClientVersion{
+		ProtocolVersion: int(protocolVersion),
+		ClientBuild:     int(clientBuild),
+		Platform:        strings.ToLower(platform),
+	}
+
+	var message string
+	version.Result, message = setting.check(version)
+
+	client.Lock()
+	client.version = &version
+	client.Unlock()
+
+	resData := ReqData{
+		DataCodeProtocolVersion: setting.ProtocolVersion,
+		DataCodeHelloResult:     version.Result,
+		DataCodeMessage:         message,
+	}
+
+	switch version.Result {
+	case HelloAccept:
+		// 客戶端要求的編碼不存在時沿用目前編碼
+		codecName := client.CodecName()
+		if requested, _ := req.GetString(DataCodeCodec); requested != "" {
+			if _, err := GetCodec(requested); err == nil {
+				codecName = requested
+			}
+		}
+
+		resData[DataCodeCodec] = codecName
+		err := req.Response(resData)
+		if err != nil {
+			client.logger.Error(fmt.Sprintf("Client hello response fail. %v", err.Error()))
+			return
+		}
+
+		// 回覆後才切換編碼，回覆本身仍使用原本的編碼
+		client.SetCodec(codecName)
+	case HelloForceUpgrade:
+		if !isSettingEmpty(setting.UpgradeURL) {
+			resData[DataCodeUpgradeURL] = setting.UpgradeURL
+		}
+		req.Response(resData)
+		client.logger.Info(fmt.Sprintf("Client from %v need upgrade. %+v", client.RemoteAddr().String(), version))
+		client.Close(ErrClientUpgradeRequired)
+	default:
+		req.Response(resData)
+		client.logger.Info(fmt.Sprintf("Client from %v rejected. %+v", client.RemoteAddr().String(), version))
+		client.Close(ErrClientRejected)
+	}
+}
+
+// 取得客戶端版本資訊，尚未完成版本協商時回傳 false
+func (client *SocketClient) Version() (ClientVersion, bool) {
+	client.RLock()
+	defer client.RUnlock()
+
+	if client.version == nil {
+		return ClientVersion{}, false
+	}
+
+	return *client.version, true
+}
+
+// 是否已通過版本協商
+func (client *SocketClient) isHelloAccepted() bool {
+	version, isExist := client.Version()
+	return isExist && version.Result == HelloAccept
+}
+
+// 依照設定檢查客戶端版本
+func (setting ProtocolSetting) check(version ClientVersion) (HelloResult, string) {
+	if version.ProtocolVersion > setting.ProtocolVersion {
+		return HelloReject, fmt.Sprintf("protocol version %v not supported", version.ProtocolVersion)
+	}
+
+	if isListed(setting.BlockedPlatforms, version.Platform) {
+		return HelloReject, fmt.Sprintf("platform %v not supported", version.Platform)
+	}
+
+	if version.ProtocolVersion < setting.MinProtocolVersion {
+		return HelloForceUpgrade, fmt.Sprintf("protocol version %v too old", version.ProtocolVersion)
+	}
+
+	minBuild := setting.MinClientBuild
+	if platformBuild, isExist := parsePlatformBuild(setting.PlatformMinBuild)[version.Platform]; isExist {
+		minBuild = platformBuild
+	}
+
+	if version.ClientBuild < minBuild {
+		return HelloForceUpgrade, fmt.Sprintf("client build %v too old", version.ClientBuild)
+	}
+
+	return HelloAccept, ""
+}
+
+// 檢查值是否在以逗號分隔的設定列表中
+func isListed(list string, value string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" && item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 解析各平台最低建置版本，格式為 "ios:120,android:118"
+func parsePlatformBuild(setting string) map[string]int {
+	builds := make(map[string]int)
+	for _, item := range strings.Split(setting, ",") {
+		pair := strings.SplitN(item, ":", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		build, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+		if err != nil {
+			continue
+		}
+
+		builds[strings.ToLower(strings.TrimSpace(pair[0]))] = build
+	}
+
+	return builds
+}
@@ -0,0 +1,135 @@
+package socketserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHelloNegotiation(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Protocol = ProtocolSetting{
+			ProtocolVersion:    3,
+			MinProtocolVersion: 2,
+			MinClientBuild:     100,
+			PlatformMinBuild:   "ios:120",
+			BlockedPlatforms:   "symbian",
+			UpgradeURL:         "https://example.com/download",
+			RequireHello:       true,
+		}
+	})
+	defer server.close()
+	server.listen()
+
+	hello := func(protocolVersion, build int, platform string, codec string) (net.Conn, *Packer, *SocketRequest) {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := NewSocketRequest(OpCodeSystem, CmdHello)
+		req.SetAll(ReqData{
+			DataCodeProtocolVersion: protocolVersion,
+			DataCodeClientBuild:     build,
+			DataCodePlatform:        platform,
+			DataCodeCodec:           codec,
+		})
+
+		packer := NewPacket(nil)
+		bd, _ := packer.PackRequest(req)
+		conn.Write(bd)
+
+		return conn, packer, readTestResponse(t, conn, packer)
+	}
+
+	cases := []struct {
+		protocolVersion int
+		build           int
+		platform        string
+		result          HelloResult
+	}{
+		{3, 100, "android", HelloAccept},
+		{4, 100, "android", HelloReject},
+		{3, 100, "symbian", HelloReject},
+		{1, 100, "android", HelloForceUpgrade},
+		{3, 99, "android", HelloForceUpgrade},
+		{3, 110, "ios", HelloForceUpgrade},
+	}
+
+	for _, c := range cases {
+		conn, _, res := hello(c.protocolVersion, c.build, c.platform, "")
+		if result, _ := res.GetInt64(DataCodeHelloResult); HelloResult(result) != c.result {
+			t.Errorf("hello result mismatch. case = %+v, result = %v", c, result)
+		}
+
+		if url, _ := res.GetString(DataCodeUpgradeURL); c.result == HelloForceUpgrade && url != "https://example.com/download" {
+			t.Errorf("upgrade url mismatch. case = %+v, url = %v", c, url)
+		}
+
+		if c.result != HelloAccept {
+			conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+			if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, io.EOF) {
+				t.Errorf("client not closed. case = %+v, err = %v", c, err)
+			}
+		}
+		conn.Close()
+	}
+
+	// 協商後改用 msgpack 編碼
+	conn, packer, res := hello(3, 200, "ios", CodecMsgPack)
+	defer conn.Close()
+	if codec, _ := res.GetString(DataCodeCodec); codec != CodecMsgPack {
+		t.Fatalf("codec not negotiated. %v", codec)
+	}
+
+	msgpackCodec, _ := GetCodec(CodecMsgPack)
+	packer.SetCodec(msgpackCodec)
+
+	req := NewSocketRequest(OperationCode(1), CommandCode(1))
+	req.Set(DataCode(0), 42)
+	bd, _ := packer.PackRequest(req)
+	conn.Write(bd)
+
+	res = readTestResponse(t, conn, packer)
+	if data, _ := res.Get(DataCode(0)); data != int64(42) {
+		t.Errorf("msgpack echo mismatch. %v(%T)", data, data)
+	}
+}
+
+func TestHelloUpgradeURLUnset(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		// config 會將空白設定轉為 "empty"
+		setting.Protocol.MinClientBuild = 100
+		setting.Protocol.UpgradeURL = "empty"
+	})
+	defer server.close()
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	req := NewSocketRequest(OpCodeSystem, CmdHello)
+	req.SetAll(ReqData{
+		DataCodeProtocolVersion: 1,
+		DataCodeClientBuild:     99,
+		DataCodePlatform:        "android",
+	})
+
+	packer := NewPacket(nil)
+	bd, _ := packer.PackRequest(req)
+	conn.Write(bd)
+
+	res := readTestResponse(t, conn, packer)
+	if result, _ := res.GetInt64(DataCodeHelloResult); HelloResult(result) != HelloForceUpgrade {
+		t.Fatalf("hello result mismatch. %v", result)
+	}
+
+	if url, isExist := res.Get(DataCodeUpgradeURL); isExist {
+		t.Fatalf("unset upgrade url sent. %v", url)
+	}
+}
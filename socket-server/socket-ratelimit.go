@@ -0,0 +1,231 @@
+package socketserver
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 超過限流時的處理方式
+const (
+	RateLimitDrop   = "drop"   // 直接丟棄請求
+	RateLimitReject = "reject" // 回覆限流錯誤
+	RateLimitKick   = "kick"   // 踢除客戶端
+)
+
+// 每多少次超過限流記錄一次日誌，避免大量請求灌爆日誌
+const rateLimitLogInterval = 100
+
+// 限流規則
+type RateLimit struct {
+	Rate   float64 // 每秒補充的請求數，0 為不限制
+	Burst  int     // 瞬間可送出的請求數，0 時依每秒請求數計算
+	Action string  // 超過限流時的處理方式: drop, reject, kick
+}
+
+// 限流統計
+type RateLimitStats struct {
+	Client    uint64                                   // 超過客戶端限流的次數
+	Operation map[OperationCode]uint64                 // 各流程超過限流的次數
+	Command   map[OperationCode]map[CommandCode]uint64 // 各流程指令超過限流的次數
+}
+
+// 令牌桶
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+// 取用一個令牌，不足時回傳 false
+func (bucket *tokenBucket) allow(now time.Time) bool {
+	bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+// 客戶端的令牌桶，依客戶端、流程、流程指令分別計算
+type clientLimiter struct {
+	sync.Mutex
+
+	client    *tokenBucket
+	operation map[OperationCode]*tokenBucket
+	command   map[commandKey]*tokenBucket
+	limited   uint64 // 超過限流的次數
+}
+
+// 確認限流處理方式
+func checkRateLimit(limit RateLimit) error {
+	switch limit.Action {
+	case RateLimitDrop, RateLimitReject, RateLimitKick:
+		return nil
+	default:
+		return fmt.Errorf("%w: %v", ErrRateLimitInvalid, limit.Action)
+	}
+}
+
+// 客戶端整體的限流規則
+func (server *SocketServer) clientRateLimit() RateLimit {
+	setting := server.AppSetting.RateLimit
+	return RateLimit{Rate: setting.ClientRate, Burst: setting.ClientBurst, Action: setting.Action}
+}
+
+// 設定指定流程的限流規則，每個客戶端分別計算，需在伺服器啟動前設定
+func (server *SocketServer) SetOperationRateLimit(opCode OperationCode, limit RateLimit) error {
+	if err := checkRateLimit(limit); err != nil {
+		return err
+	}
+
+	if limit.Rate <= 0 {
+		delete(server.opLimits, opCode)
+	} else {
+		server.opLimits[opCode] = limit
+	}
+
+	return nil
+}
+
+// 設定指定流程指令的限流規則，每個客戶端分別計算，需在伺服器啟動前設定
+func (server *SocketServer) SetCommandRateLimit(opCode OperationCode, cmdCode CommandCode, limit RateLimit) error {
+	if err := checkRateLimit(limit); err != nil {
+		return err
+	}
+
+	key := commandKey{opCode: opCode, cmdCode: cmdCode}
+	if limit.Rate <= 0 {
+		delete(server.cmdLimits, key)
+	} else {
+		server.cmdLimits[key] = limit
+	}
+
+	return nil
+}
+
+// 取得限流統計
+func (server *SocketServer) RateLimitStats() RateLimitStats {
+	server.limitLock.Lock()
+	defer server.limitLock.Unlock()
+
+	stats := RateLimitStats{
+		Client:    server.limitStats.Client,
+		Operation: make(map[OperationCode]uint64, len(server.limitStats.Operation)),
+		Command:   make(map[OperationCode]map[CommandCode]uint64, len(server.limitStats.Command)),
+	}
+
+	for opCode, count := range server.limitStats.Operation {
+		stats.Operation[opCode] = count
+	}
+
+	for opCode, commands := range server.limitStats.Command {
+		stats.Command[opCode] = make(map[CommandCode]uint64, len(commands))
+		for cmdCode, count := range commands {
+			stats.Command[opCode][cmdCode] = count
+		}
+	}
+
+	return stats
+}
+
+// 記錄超過限流
+func (server *SocketServer) countRateLimited(scope string, opCode OperationCode, cmdCode CommandCode) {
+	server.limitLock.Lock()
+	defer server.limitLock.Unlock()
+
+	switch scope {
+	case "client":
+		server.limitStats.Client++
+	case "operation":
+		server.limitStats.Operation[opCode]++
+	case "command":
+		if server.limitStats.Command[opCode] == nil {
+			server.limitStats.Command[opCode] = make(map[CommandCode]uint64)
+		}
+		server.limitStats.Command[opCode][cmdCode]++
+	}
+}
+
+// 取得客戶端超過限流的次數
+func (client *SocketClient) RateLimited() uint64 {
+	return atomic.LoadUint64(&client.limiter.limited)
+}
+
+// 檢查請求是否超過限流，超過時依規則丟棄、回覆錯誤或踢除客戶端，回傳是否允許執行
+func (client *SocketClient) allowRequest(req *SocketRequest) bool {
+	server := client.server
+	opCode, cmdCode := req.OperationCode(), req.CommandCode()
+	now := time.Now()
+
+	scope := ""
+	var limit RateLimit
+
+	client.limiter.Lock()
+	if client_limit := server.clientRateLimit(); client_limit.Rate > 0 {
+		if client.limiter.client == nil {
+			client.limiter.client = newTokenBucket(client_limit, now)
+		}
+		if !client.limiter.client.allow(now) {
+			scope, limit = "client", client_limit
+		}
+	}
+
+	if op_limit, isExist := server.opLimits[opCode]; scope == "" && isExist {
+		bucket, isExist := client.limiter.operation[opCode]
+		if !isExist {
+			bucket = newTokenBucket(op_limit, now)
+			client.limiter.operation[opCode] = bucket
+		}
+		if !bucket.allow(now) {
+			scope, limit = "operation", op_limit
+		}
+	}
+
+	key := commandKey{opCode: opCode, cmdCode: cmdCode}
+	if cmd_limit, isExist := server.cmdLimits[key]; scope == "" && isExist {
+		bucket, isExist := client.limiter.command[key]
+		if !isExist {
+			bucket = newTokenBucket(cmd_limit, now)
+			client.limiter.command[key] = bucket
+		}
+		if !bucket.allow(now) {
+			scope, limit = "command", cmd_limit
+		}
+	}
+	client.limiter.Unlock()
+
+	if scope == "" {
+		return true
+	}
+
+	count := atomic.AddUint64(&client.limiter.limited, 1)
+	server.countRateLimited(scope, opCode, cmdCode)
+	if count == 1 || count%rateLimitLogInterval == 0 || limit.Action == RateLimitKick {
+		client.logger.Warn(fmt.Sprintf("Client %v rate limited. scope = %v, Op code = %v, Cmd code = %v, action = %v, count = %v", client.id, scope, opCode, cmdCode, limit.Action, count))
+	}
+
+	switch limit.Action {
+	case RateLimitReject:
+		req.ResponseError(ErrorCodeRateLimited, "rate limited")
+	case RateLimitKick:
+		client.Kick("rate limit exceeded")
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+package socketserver
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(RateLimit{Rate: 10, Burst: 2}, now)
+
+	if !bucket.allow(now) || !bucket.allow(now) {
+		t.Fatal("burst request denied")
+	}
+
+	if bucket.allow(now) {
+		t.Fatal("request over burst allowed")
+	}
+
+	// 每 100 毫秒補充一個令牌
+	if !bucket.allow(now.Add(time.Millisecond * 100)) {
+		t.Fatal("refilled request denied")
+	}
+
+	if bucket.allow(now.Add(time.Millisecond * 100)) {
+		t.Fatal("request over refill allowed")
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	err := server.SetOperationRateLimit(OperationCode(2), RateLimit{Rate: 1, Action: "unknown"})
+	if !errors.Is(err, ErrRateLimitInvalid) {
+		t.Fatalf("rate limit action not checked. %v", err)
+	}
+}
+
+func TestRateLimitReject(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	server.AddOperation(&echoOperation{opCode: OperationCode(2)})
+	if err := server.SetCommandRateLimit(OperationCode(2), CommandCode(1), RateLimit{Rate: 0.1, Burst: 1, Action: RateLimitReject}); err != nil {
+		t.Fatal(err)
+	}
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 指令 1 只允許第一個請求，指令 2 不受限制
+	packer := NewPacket(nil)
+	for id, cmd := range []CommandCode{1, 1, 1, 2} {
+		bd, _ := packer.PackFrame(ReqID(id+1), time.Now(), OperationCode(2), cmd, ReqData{DataCode(0): id})
+		conn.Write(bd)
+	}
+
+	limited, done := 0, 0
+	for i := 0; i < 4; i++ {
+		res := readTestResponse(t, conn, packer)
+		if res.OperationCode() == OpCodeSystem && res.CommandCode() == CmdError {
+			if code, _ := res.GetInt64(DataCodeErrorCode); ErrorCode(code) != ErrorCodeRateLimited {
+				t.Fatalf("error code mismatch. %v", code)
+			}
+			limited++
+		} else {
+			done++
+		}
+	}
+
+	if limited != 2 || done != 2 {
+		t.Fatalf("rate limit count mismatch. limited = %v, done = %v", limited, done)
+	}
+
+	stats := server.RateLimitStats()
+	if stats.Command[OperationCode(2)][CommandCode(1)] != 2 || stats.Client != 0 {
+		t.Fatalf("rate limit stats mismatch. %+v", stats)
+	}
+
+	clients := server.ClientRegistry.List()
+	if len(clients) != 1 || clients[0].RateLimited() != 2 {
+		t.Fatal("client rate limit count mismatch")
+	}
+}
+
+func TestRateLimitKick(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.RateLimit = RateLimitSetting{ClientRate: 0.1, ClientBurst: 1, Action: RateLimitKick}
+	})
+	defer server.close()
+
+	server.AddOperation(&echoOperation{opCode: OperationCode(2)})
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	packer := NewPacket(nil)
+	for id := ReqID(1); id <= 2; id++ {
+		bd, _ := packer.PackFrame(id, time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): int(id)})
+		conn.Write(bd)
+	}
+
+	kicked := false
+	for !kicked {
+		res := readTestResponse(t, conn, packer)
+		kicked = res.OperationCode() == OpCodeSystem && res.CommandCode() == CmdKick
+	}
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if _, err := conn.Read(buffer); err != io.EOF {
+		t.Fatalf("connection not closed after kick. %v", err)
+	}
+
+	if stats := server.RateLimitStats(); stats.Client != 1 {
+		t.Fatalf("rate limit stats mismatch. %+v", stats)
+	}
+}
+
+func TestRateLimitSystem(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.RateLimit = RateLimitSetting{ClientRate: 0.1, ClientBurst: 2, Action: RateLimitDrop}
+	})
+	defer server.close()
+
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 心跳同樣受客戶端限流，超過的心跳不回覆
+	packer := NewPacket(nil)
+	for id := 1; id <= 5; id++ {
+		bd, _ := packer.PackFrame(ReqID(id), time.Now(), OpCodeSystem, CmdPing, ReqData{})
+		conn.Write(bd)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := readTestResponse(t, conn, packer); res.CommandCode() != CmdPong {
+			t.Fatalf("pong mismatch. %+v", res)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Millisecond * 300))
+	if n, _ := conn.Read(make([]byte, 1024)); n > 0 {
+		t.Fatalf("pong over rate limit sent. %v bytes", n)
+	}
+
+	if stats := server.RateLimitStats(); stats.Client != 3 {
+		t.Fatalf("client rate limit count mismatch. %v", stats.Client)
+	}
+}
@@ -0,0 +1,198 @@
+package socketserver
+
+import (
+	"reflect"
+	"sync"
+)
+
+// 客戶端列表，可由流程器同時存取
+type ClientRegistry struct {
+	sync.RWMutex
+
+	clients     map[string]*SocketClient                         // 客戶端編號對應的客戶端
+	index       map[ClientInfoCode]map[interface{}]*SocketClient // 自訂資料值對應的客戶端
+	clientIndex map[*SocketClient]map[ClientInfoCode]interface{} // 客戶端已建立索引的自訂資料
+}
+
+// 產生新的客戶端列表
+func NewClientRegistry() *ClientRegistry {
+	return &ClientRegistry{
+		clients:     make(map[string]*SocketClient),
+		index:       make(map[ClientInfoCode]map[interface{}]*SocketClient),
+		clientIndex: make(map[*SocketClient]map[ClientInfoCode]interface{}),
+	}
+}
+
+// 對指定自訂資料建立索引，例如玩家編號，之後設定此資料時會同步更新索引
+func (registry *ClientRegistry) AddIndex(code ClientInfoCode) {
+	registry.Lock()
+	if _, isExist := registry.index[code]; isExist {
+		registry.Unlock()
+		return
+	}
+	registry.index[code] = make(map[interface{}]*SocketClient)
+
+	clients := make([]*SocketClient, 0, len(registry.clients))
+	for _, client := range registry.clients {
+		clients = append(clients, client)
+	}
+	registry.Unlock()
+
+	// 補上已存在的客戶端
+	for _, client := range clients {
+		client.RLock()
+		data, isExist := client.customInfo[code]
+		if isExist {
+			registry.setIndex(client, code, data)
+		}
+		client.RUnlock()
+	}
+}
+
+// 加入客戶端，回傳被取代的同編號客戶端
+func (registry *ClientRegistry) add(client *SocketClient) *SocketClient {
+	registry.Lock()
+	defer registry.Unlock()
+
+	previous := registry.clients[client.id]
+	registry.clients[client.id] = client
+
+	if previous != nil {
+		registry.removeIndex(previous)
+	}
+
+	return previous
+}
+
+// 移除客戶端及其索引
+func (registry *ClientRegistry) remove(client *SocketClient) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.clients[client.id] == client {
+		delete(registry.clients, client.id)
+	}
+
+	registry.removeIndex(client)
+}
+
+// 更新索引，客戶端鎖需由呼叫端持有以確保更新順序
+func (registry *ClientRegistry) setIndex(client *SocketClient, code ClientInfoCode, data interface{}) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	values, isIndexed := registry.index[code]
+	if !isIndexed {
+		return
+	}
+
+	// 客戶端已移出列表時不再建立索引
+	if registry.clients[client.id] != client {
+		return
+	}
+
+	registry.clearIndex(client, code)
+
+	if data == nil || !reflect.TypeOf(data).Comparable() {
+		return
+	}
+
+	// 相同資料值以最後設定的客戶端為準
+	values[data] = client
+	if _, isExist := registry.clientIndex[client]; !isExist {
+		registry.clientIndex[client] = make(map[ClientInfoCode]interface{})
+	}
+	registry.clientIndex[client][code] = data
+}
+
+// 移除客戶端指定自訂資料的索引，呼叫前必須持有鎖
+func (registry *ClientRegistry) clearIndex(client *SocketClient, code ClientInfoCode) {
+	codes, isExist := registry.clientIndex[client]
+	if !isExist {
+		return
+	}
+
+	data, isExist := codes[code]
+	if !isExist {
+		return
+	}
+
+	if registry.index[code][data] == client {
+		delete(registry.index[code], data)
+	}
+
+	delete(codes, code)
+	if len(codes) == 0 {
+		delete(registry.clientIndex, client)
+	}
+}
+
+// 移除客戶端所有索引，呼叫前必須持有鎖
+func (registry *ClientRegistry) removeIndex(client *SocketClient) {
+	for code := range registry.clientIndex[client] {
+		registry.clearIndex(client, code)
+	}
+}
+
+// 依照客戶端編號取得客戶端
+func (registry *ClientRegistry) Get(id string) (*SocketClient, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	client, isExist := registry.clients[id]
+	return client, isExist
+}
+
+// 依照自訂資料取得客戶端，未建立索引的資料會逐一比對，無法比較的資料 (map、slice、func) 一律找不到
+func (registry *ClientRegistry) GetByInfo(code ClientInfoCode, data interface{}) (*SocketClient, bool) {
+	if data == nil || !reflect.TypeOf(data).Comparable() {
+		return nil, false
+	}
+
+	registry.RLock()
+	values, isIndexed := registry.index[code]
+	if isIndexed {
+		defer registry.RUnlock()
+
+		client, isExist := values[data]
+		return client, isExist
+	}
+	registry.RUnlock()
+
+	for _, client := range registry.List() {
+		if client.Get(code) == data {
+			return client, true
+		}
+	}
+
+	return nil, false
+}
+
+// 取得所有客戶端
+func (registry *ClientRegistry) List() []*SocketClient {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	clients := make([]*SocketClient, 0, len(registry.clients))
+	for _, client := range registry.clients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// 取得客戶端數量，包含斷線保留中的客戶端
+func (registry *ClientRegistry) Count() int {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return len(registry.clients)
+}
+
+// 取得已設定指定自訂資料的客戶端數量，例如已登入的玩家數，資料需已建立索引
+func (registry *ClientRegistry) CountByInfo(code ClientInfoCode) int {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	return len(registry.index[code])
+}
@@ -0,0 +1,87 @@
+package socketserver
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientRegistry(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+	server.listen()
+
+	const playerCode ClientInfoCode = 1
+	const levelCode ClientInfoCode = 2
+	registry := server.ClientRegistry
+	registry.AddIndex(playerCode)
+
+	conns := make(map[string]net.Conn)
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[conn.LocalAddr().String()] = conn
+	}
+
+	clients := waitTestClients(t, server, len(conns))
+	if registry.Count() != 2 {
+		t.Fatalf("registry count mismatch. %v", registry.Count())
+	}
+
+	if client, isExist := registry.Get(clients[0].ID()); !isExist || client != clients[0] {
+		t.Fatal("get client by id fail")
+	}
+
+	clients[0].Set(playerCode, "player-a")
+	clients[1].Set(playerCode, "player-b")
+	clients[1].Set(levelCode, 10)
+
+	if client, isExist := registry.GetByInfo(playerCode, "player-b"); !isExist || client != clients[1] {
+		t.Fatal("get client by indexed info fail")
+	}
+
+	// 未建立索引的資料逐一比對
+	if client, isExist := registry.GetByInfo(levelCode, 10); !isExist || client != clients[1] {
+		t.Fatal("get client by info fail")
+	}
+
+	// 無法比較的資料不可造成 panic
+	const tagCode ClientInfoCode = 3
+	clients[0].Set(tagCode, map[string]int{"a": 1})
+	clients[1].Set(tagCode, []string{"b"})
+	if _, isExist := registry.GetByInfo(tagCode, map[string]int{"a": 1}); isExist {
+		t.Fatal("get client by map info should not match")
+	}
+	if _, isExist := registry.GetByInfo(tagCode, "a"); isExist {
+		t.Fatal("get client by mismatched info type should not match")
+	}
+
+	if registry.CountByInfo(playerCode) != 2 {
+		t.Fatalf("indexed count mismatch. %v", registry.CountByInfo(playerCode))
+	}
+
+	clients[0].Clear(playerCode)
+	if _, isExist := registry.GetByInfo(playerCode, "player-a"); isExist {
+		t.Fatal("cleared info still indexed")
+	}
+
+	// 關閉的客戶端自動移出列表
+	conns[clients[1].RemoteAddr().String()].Close()
+	for retry := 0; registry.Count() != 1; retry++ {
+		if retry > 100 {
+			t.Fatal("closed client not removed")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	if _, isExist := registry.GetByInfo(playerCode, "player-b"); isExist {
+		t.Fatal("closed client still indexed")
+	}
+
+	if registry.CountByInfo(playerCode) != 0 {
+		t.Fatalf("indexed count after close mismatch. %v", registry.CountByInfo(playerCode))
+	}
+}
@@ -1,7 +1,9 @@
 package socketserver
 
 import (
+	"context"
 	"errors"
+	"reflect"
 	"time"
 )
 
@@ -10,7 +12,7 @@ var ErrClientNotSet error = errors.New("request client null")
 
 func NewSocketRequest(_opCode OperationCode, _cmdCode CommandCode) (request *SocketRequest) {
 	request = &SocketRequest{
-		uid: ReqUID(time.Now().UnixMilli()),
+		uid:     ReqUID(time.Now().UnixMilli()),
 		opCode:  _opCode,
 		cmdCode: _cmdCode,
 		reqData: make(ReqData),
@@ -21,11 +23,23 @@ func NewSocketRequest(_opCode OperationCode, _cmdCode CommandCode) (request *Soc
 
 // Socket 請求
 type SocketRequest struct {
+	id      ReqID // 請求編號，由發送端依連線遞增產生，回覆時原樣帶回
 	uid     ReqUID
 	reqData ReqData
 	opCode  OperationCode
 	cmdCode CommandCode
 	client  *SocketClient
+	ctx     context.Context // 流程執行期間的 context
+	preAuth bool            // 已計入客戶端等待中的登入前流程
+}
+
+// 取得流程執行期間的 context，尚未執行時回傳 context.Background
+func (req *SocketRequest) Context() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+
+	return req.ctx
 }
 
 // 取得請求編號
@@ -33,6 +47,16 @@ func (req SocketRequest) GetUID() ReqUID {
 	return req.uid
 }
 
+// 取得請求編號，用於對應請求與回覆，0 為伺服器主動推送
+func (req SocketRequest) GetID() ReqID {
+	return req.id
+}
+
+// 設置請求編號
+func (req *SocketRequest) SetID(id ReqID) {
+	req.id = id
+}
+
 // 取得請求時間
 func (req SocketRequest) GetRequestTime() time.Time {
 	return time.UnixMilli(int64(req.uid))
@@ -66,6 +90,37 @@ func (req *SocketRequest) Get(code DataCode) (interface{}, bool) {
 	return data, isExist
 }
 
+// 取得整數資料，不同編碼器解析出的數字型別皆可轉換
+func (req *SocketRequest) GetInt64(code DataCode) (int64, bool) {
+	data, isExist := req.reqData[code]
+	if !isExist {
+		return 0, false
+	}
+
+	return toInt64(data)
+}
+
+// 取得浮點數資料，不同編碼器解析出的數字型別皆可轉換
+func (req *SocketRequest) GetFloat64(code DataCode) (float64, bool) {
+	data, isExist := req.reqData[code]
+	if !isExist {
+		return 0, false
+	}
+
+	return toFloat64(data)
+}
+
+// 取得字串資料
+func (req *SocketRequest) GetString(code DataCode) (string, bool) {
+	data, isExist := req.reqData[code]
+	if !isExist {
+		return "", false
+	}
+
+	str, isString := data.(string)
+	return str, isString
+}
+
 // 依照資料編號設置資料
 func (req *SocketRequest) Set(code DataCode, data interface{}) {
 	req.reqData[code] = data
@@ -87,7 +142,21 @@ func (req *SocketRequest) Response(reqData ReqData) error {
 		return ErrClientNotSet
 	}
 
-	return req.client.Send(req.GetRequestTime(), req.opCode, req.cmdCode, reqData)
+	return req.client.send(req.id, req.GetRequestTime(), req.opCode, req.cmdCode, reqData)
+}
+
+// 以錯誤回覆此請求，客戶端以系統流程的錯誤指令接收
+func (req *SocketRequest) ResponseError(code ErrorCode, message string) error {
+	if req.client == nil {
+		return ErrClientNotSet
+	}
+
+	return req.client.send(req.id, req.GetRequestTime(), OpCodeSystem, CmdError, ReqData{
+		DataCodeErrorCode:        code,
+		DataCodeMessage:          message,
+		DataCodeRequestOperation: req.opCode,
+		DataCodeRequestCommand:   req.cmdCode,
+	})
 }
 
 // 發送資料
@@ -99,8 +168,39 @@ func (req *SocketRequest) Send(sendTime time.Time, opCode OperationCode, cmdCode
 	return req.client.Send(sendTime, opCode, cmdCode, reqData)
 }
 
+// 將數字資料轉為 int64
+func toInt64(data interface{}) (int64, bool) {
+	rv := reflect.ValueOf(data)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float()), true
+	}
+
+	return 0, false
+}
+
+// 將數字資料轉為 float64
+func toFloat64(data interface{}) (float64, bool) {
+	rv := reflect.ValueOf(data)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
 type OperationCode byte
 type CommandCode byte
 type DataCode uint16
 type ReqUID int64
+type ReqID uint32
 type ReqData map[DataCode]interface{}
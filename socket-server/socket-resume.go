@@ -0,0 +1,254 @@
+package socketserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+type ResumeResult byte
+
+const (
+	ResumeSuccess    ResumeResult = 0 // 已恢復原本的連線狀態
+	ResumeNewSession ResumeResult = 1 // 憑證無效或已過期，以新的連線狀態開始
+	ResumeDisabled   ResumeResult = 2 // 伺服器未啟用斷線重連
+)
+
+// 斷線期間暫存的封包
+type missedFrame struct {
+	reqID   ReqID
+	reqTime time.Time
+	opCode  OperationCode
+	cmdCode CommandCode
+	reqData ReqData
+}
+
+// 是否啟用斷線重連
+func (server *SocketServer) resumeEnabled() bool {
+	return server.AppSetting.Server.ResumeGraceTime > 0
+}
+
+// 發放新的恢復連線憑證，舊的憑證同時失效
+func (server *SocketServer) issueResumeToken(client *SocketClient) string {
+	buffer := make([]byte, 16)
+	rand.Read(buffer)
+	token := hex.EncodeToString(buffer)
+
+	server.sessionLock.Lock()
+	defer server.sessionLock.Unlock()
+
+	if client.resumeToken != "" {
+		delete(server.sessions, client.resumeToken)
+	}
+
+	client.resumeToken = token
+	server.sessions[token] = client
+	return token
+}
+
+// 取出憑證對應的客戶端，憑證只能使用一次
+func (server *SocketServer) takeSession(token string, except *SocketClient) *SocketClient {
+	server.sessionLock.Lock()
+	defer server.sessionLock.Unlock()
+
+	client, isExist := server.sessions[token]
+	if !isExist || client == except {
+		return nil
+	}
+
+	delete(server.sessions, token)
+	client.resumeToken = ""
+	return client
+}
+
+// 移除客戶端的恢復連線憑證
+func (server *SocketServer) dropResumeToken(client *SocketClient) {
+	server.sessionLock.Lock()
+	defer server.sessionLock.Unlock()
+
+	if client.resumeToken != "" {
+		delete(server.sessions, client.resumeToken)
+		client.resumeToken = ""
+	}
+}
+
+// 保留期間結束，正式關閉客戶端
+func (server *SocketServer) expireSession(client *SocketClient) {
+	client.Lock()
+	if !client.detached || client.expired {
+		client.Unlock()
+		return
+	}
+
+	client.expired = true
+	reason := client.detachReason
+	server.dropResumeToken(client)
+	client.Unlock()
+
+	client.Close(fmt.Errorf("%w: %v", ErrResumeExpired, reason))
+}
+
+// 連線中斷，可恢復時保留連線狀態，否則直接關閉
+func (client *SocketClient) disconnect(conn net.Conn, err error) {
+	server := client.server
+
+	client.Lock()
+	if client.connection != conn {
+		client.Unlock()
+		return
+	}
+
+	if !server.resumeEnabled() || !client.connected || client.expired {
+		client.Unlock()
+		client.Close(err)
+		return
+	}
+
+	outbox := client.outbox
+	client.connection = nil
+	client.outbox = nil
+	client.detached = true
+	client.detachReason = err
+	client.missed = nil
+	client.resumeTimer = time.AfterFunc(time.Second*time.Duration(server.AppSetting.Server.ResumeGraceTime), func() {
+		server.expireSession(client)
+	})
+	client.Unlock()
+
+	if outbox != nil {
+		outbox.close(true)
+	}
+	conn.Close()
+	client.logger.Info(fmt.Sprintf("Client %v detached, wait %v secs for resume. Reason: %v", client.id, server.AppSetting.Server.ResumeGraceTime, err.Error()))
+}
+
+// 暫存斷線期間的封包，超過上限則放棄保留連線狀態，呼叫前必須持有鎖
+func (client *SocketClient) queueMissed(reqID ReqID, reqTime time.Time, opCode OperationCode, cmdCode CommandCode, reqData ReqData) error {
+	if client.expired {
+		return ErrConnectionNull
+	}
+
+	maxPending := client.server.AppSetting.Server.ResumeMaxPending
+	if maxPending > 0 && len(client.missed) >= maxPending {
+		client.expired = true
+		client.missed = nil
+		client.server.dropResumeToken(client)
+		go client.Close(ErrResumeOverflow)
+		return ErrResumeOverflow
+	}
+
+	client.missed = append(client.missed, missedFrame{
+		reqID:   reqID,
+		reqTime: reqTime,
+		opCode:  opCode,
+		cmdCode: cmdCode,
+		reqData: reqData,
+	})
+
+	return nil
+}
+
+// 處理恢復連線請求，憑證無效時以新的連線狀態開始
+func (client *SocketClient) handleResume(req *SocketRequest) {
+	if !client.server.resumeEnabled() {
+		req.Response(ReqData{DataCodeResumeResult: ResumeDisabled})
+		return
+	}
+
+	token, _ := req.GetString(DataCodeResumeToken)
+	if token != "" && !client.isConnected() {
+		if session := client.server.takeSession(token, client); session != nil && session.attach(client, req) {
+			return
+		}
+	}
+
+	req.Response(ReqData{DataCodeResumeResult: ResumeNewSession})
+	client.notifyConnect()
+}
+
+// 將新連線接回原本的客戶端，回覆恢復結果並補發斷線期間的封包
+func (client *SocketClient) attach(temp *SocketClient, req *SocketRequest) bool {
+	client.Lock()
+
+	select {
+	case <-client.closed:
+		client.Unlock()
+		return false
+	default:
+	}
+
+	if client.expired {
+		client.Unlock()
+		return false
+	}
+
+	temp.Lock()
+	conn, packer, remoteAddr, version := temp.connection, temp.packer, temp.remoteAddr, temp.version
+	outbox := temp.outbox
+	temp.connection = nil
+	temp.outbox = nil
+	temp.Unlock()
+
+	if conn == nil {
+		client.Unlock()
+		return false
+	}
+
+	if client.resumeTimer != nil {
+		client.resumeTimer.Stop()
+		client.resumeTimer = nil
+	}
+
+	// 原本的連線可能尚未發現中斷
+	prevConn, prevOutbox := client.connection, client.outbox
+
+	// 寫出佇列隨連線轉移，協商回覆等已排入的封包才會先送出
+	client.connection = conn
+	client.outbox = outbox
+	client.packer = packer
+	client.remoteAddr = remoteAddr
+	client.lastConnectTime = time.Now().UTC()
+	if version != nil {
+		client.version = version
+	}
+
+	missed := client.missed
+	client.missed = nil
+	client.detached = false
+
+	token := client.server.issueResumeToken(client)
+
+	// 回覆與補發需在鎖內完成，避免與其他推送交錯
+	err := client.write(req.id, time.Now(), OpCodeSystem, CmdResume, ReqData{
+		DataCodeResumeResult: ResumeSuccess,
+		DataCodeResumeToken:  token,
+	})
+	for i := 0; err == nil && i < len(missed); i++ {
+		err = client.write(missed[i].reqID, missed[i].reqTime, missed[i].opCode, missed[i].cmdCode, missed[i].reqData)
+	}
+	client.Unlock()
+
+	if err != nil {
+		client.logger.Warn(fmt.Sprintf("Client %v resume response fail. %v", client.id, err.Error()))
+	}
+
+	if prevOutbox != nil {
+		prevOutbox.close(true)
+	}
+	if prevConn != nil {
+		prevConn.Close()
+	}
+
+	temp.Close(ErrSessionResumed)
+
+	client.logger.Info(fmt.Sprintf("Client %v resumed from %v, replay %v frames", client.id, remoteAddr.String(), len(missed)))
+
+	go client.readLoop(conn, packer)
+	go client.timeoutLoop(conn)
+	go client.heartbeatLoop(conn)
+
+	client.server.OnClientResume(client)
+	return true
+}
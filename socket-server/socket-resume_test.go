@@ -0,0 +1,154 @@
+package socketserver
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 記錄客戶端生命週期事件的流程器
+type lifecycleOperation struct {
+	echoOperation
+	sync.Mutex
+
+	client                       *SocketClient
+	connect, disconnect, resumed int
+}
+
+func (op *lifecycleOperation) OnClientConnect(client *SocketClient) error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.client = client
+	op.connect++
+	return nil
+}
+
+func (op *lifecycleOperation) OnClientDisconnect(*SocketClient) error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.disconnect++
+	return nil
+}
+
+func (op *lifecycleOperation) OnClientResume(*SocketClient) error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.resumed++
+	return nil
+}
+
+func (op *lifecycleOperation) counts() (int, int, int) {
+	op.Lock()
+	defer op.Unlock()
+
+	return op.connect, op.disconnect, op.resumed
+}
+
+func TestSessionResume(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.ResumeGraceTime = 1
+		setting.Server.ResumeMaxPending = 16
+	})
+	defer server.close()
+
+	op := &lifecycleOperation{echoOperation: echoOperation{opCode: OperationCode(2)}}
+	server.AddOperation(op)
+	server.listen()
+
+	resume := func(token string) (net.Conn, *Packer, *SocketRequest) {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packer := NewPacket(nil)
+		bd, _ := packer.PackFrame(1, time.Now(), OpCodeSystem, CmdResume, ReqData{DataCodeResumeToken: token})
+		conn.Write(bd)
+
+		return conn, packer, readTestResponse(t, conn, packer)
+	}
+
+	// 第一次連線沒有憑證，以新的連線狀態開始並取得憑證
+	conn, packer, res := resume("")
+	if result, _ := res.GetInt64(DataCodeResumeResult); ResumeResult(result) != ResumeNewSession {
+		t.Fatalf("first resume result mismatch. %v", result)
+	}
+
+	push := readTestResponse(t, conn, packer)
+	token, _ := push.GetString(DataCodeResumeToken)
+	if push.CommandCode() != CmdResumeToken || token == "" {
+		t.Fatalf("resume token not issued. %+v", push)
+	}
+
+	op.Lock()
+	client := op.client
+	op.Unlock()
+	client.Set(ClientInfoCode(1), "player-1")
+
+	// 斷線後推送的資料暫存起來
+	conn.Close()
+	time.Sleep(time.Millisecond * 200)
+	if err := client.Send(time.Now(), OperationCode(2), CommandCode(9), ReqData{DataCode(0): "missed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 恢復連線期間同時讀取遠端位址，以 -race 檢查
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				client.RemoteAddr()
+			}
+		}
+	}()
+
+	conn, packer, res = resume(token)
+	close(stop)
+	if result, _ := res.GetInt64(DataCodeResumeResult); ResumeResult(result) != ResumeSuccess {
+		t.Fatalf("resume fail. %v", result)
+	}
+
+	if client.RemoteAddr().String() != conn.LocalAddr().String() {
+		t.Fatalf("remote address not updated after resume. %v", client.RemoteAddr())
+	}
+
+	replay := readTestResponse(t, conn, packer)
+	if message, _ := replay.GetString(DataCode(0)); replay.CommandCode() != CommandCode(9) || message != "missed" {
+		t.Fatalf("missed frame not replayed. %+v", replay)
+	}
+
+	if client.Get(ClientInfoCode(1)) != "player-1" {
+		t.Fatal("custom info lost after resume")
+	}
+
+	// 恢復後的連線仍可正常收發
+	bd, _ := packer.PackFrame(2, time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): "echo"})
+	conn.Write(bd)
+	if echo := readTestResponse(t, conn, packer); echo.GetID() != 2 {
+		t.Fatalf("echo after resume mismatch. %+v", echo)
+	}
+
+	if connect, disconnect, resumed := op.counts(); connect != 1 || disconnect != 0 || resumed != 1 {
+		t.Fatalf("lifecycle mismatch. connect = %v, disconnect = %v, resumed = %v", connect, disconnect, resumed)
+	}
+
+	// 超過保留期間才發出斷線事件，舊憑證也不能再使用
+	conn.Close()
+	time.Sleep(time.Millisecond * 1500)
+	if _, disconnect, _ := op.counts(); disconnect != 1 {
+		t.Fatalf("disconnect not notified after grace time. %v", disconnect)
+	}
+
+	conn, _, res = resume(token)
+	defer conn.Close()
+	if result, _ := res.GetInt64(DataCodeResumeResult); ResumeResult(result) != ResumeNewSession {
+		t.Fatalf("expired token should start new session. %v", result)
+	}
+}
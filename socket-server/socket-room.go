@@ -0,0 +1,247 @@
+package socketserver
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 房間，用於大廳、對戰、聊天頻道等客戶端分組
+type Room struct {
+	sync.RWMutex
+
+	id      string
+	server  *SocketServer
+	members map[*SocketClient]bool
+}
+
+// 取得房間編號
+func (room *Room) ID() string {
+	return room.id
+}
+
+// 取得房間成員
+func (room *Room) Members() []*SocketClient {
+	room.RLock()
+	defer room.RUnlock()
+
+	members := make([]*SocketClient, 0, len(room.members))
+	for client := range room.members {
+		members = append(members, client)
+	}
+
+	return members
+}
+
+// 取得房間人數
+func (room *Room) Count() int {
+	room.RLock()
+	defer room.RUnlock()
+
+	return len(room.members)
+}
+
+// 客戶端是否在房間內
+func (room *Room) Has(client *SocketClient) bool {
+	room.RLock()
+	defer room.RUnlock()
+
+	return room.members[client]
+}
+
+// 發送封包給房間所有成員
+func (room *Room) Broadcast(opCode OperationCode, cmdCode CommandCode, reqData ReqData) (int, error) {
+	return room.server.fanOut(room.Members(), opCode, cmdCode, reqData)
+}
+
+// 發送封包給除了指定客戶端以外的房間成員
+func (room *Room) BroadcastExcept(except *SocketClient, opCode OperationCode, cmdCode CommandCode, reqData ReqData) (int, error) {
+	members := room.Members()
+	targets := make([]*SocketClient, 0, len(members))
+	for _, client := range members {
+		if client != except {
+			targets = append(targets, client)
+		}
+	}
+
+	return room.server.fanOut(targets, opCode, cmdCode, reqData)
+}
+
+// 房間管理
+type RoomManager struct {
+	sync.RWMutex
+
+	server      *SocketServer
+	rooms       map[string]*Room
+	clientRooms map[*SocketClient]map[string]*Room // 客戶端所在的房間
+}
+
+// 產生新的房間管理
+func NewRoomManager(server *SocketServer) *RoomManager {
+	return &RoomManager{
+		server:      server,
+		rooms:       make(map[string]*Room),
+		clientRooms: make(map[*SocketClient]map[string]*Room),
+	}
+}
+
+// 建立房間
+func (manager *RoomManager) CreateRoom(id string) (*Room, error) {
+	manager.Lock()
+	if _, isExist := manager.rooms[id]; isExist {
+		manager.Unlock()
+		return nil, fmt.Errorf("%w: %v", ErrRoomExist, id)
+	}
+
+	room := &Room{
+		id:      id,
+		server:  manager.server,
+		members: make(map[*SocketClient]bool),
+	}
+	manager.rooms[id] = room
+	manager.Unlock()
+
+	manager.server.OnRoomCreate(room)
+	return room, nil
+}
+
+// 取得房間
+func (manager *RoomManager) GetRoom(id string) (*Room, bool) {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	room, isExist := manager.rooms[id]
+	return room, isExist
+}
+
+// 取得所有房間
+func (manager *RoomManager) Rooms() []*Room {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	rooms := make([]*Room, 0, len(manager.rooms))
+	for _, room := range manager.rooms {
+		rooms = append(rooms, room)
+	}
+
+	return rooms
+}
+
+// 刪除房間，成員一併移出
+func (manager *RoomManager) DestroyRoom(id string) error {
+	manager.Lock()
+	room, isExist := manager.rooms[id]
+	if !isExist {
+		manager.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoomNotExist, id)
+	}
+
+	delete(manager.rooms, id)
+
+	room.Lock()
+	for client := range room.members {
+		manager.removeClientRoom(client, id)
+	}
+	room.members = make(map[*SocketClient]bool)
+	room.Unlock()
+	manager.Unlock()
+
+	manager.server.OnRoomDestroy(room)
+	return nil
+}
+
+// 加入房間
+func (manager *RoomManager) Join(id string, client *SocketClient) error {
+	manager.Lock()
+
+	// 需在鎖內確認，關閉時 closed 會先於 leaveAll 關閉，之後加入的請求一定會被拒絕
+	select {
+	case <-client.Closed():
+		manager.Unlock()
+		return ErrClientStop
+	default:
+	}
+
+	room, isExist := manager.rooms[id]
+	if !isExist {
+		manager.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoomNotExist, id)
+	}
+
+	room.Lock()
+	if room.members[client] {
+		room.Unlock()
+		manager.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoomJoined, id)
+	}
+	room.members[client] = true
+	room.Unlock()
+
+	if _, isExist = manager.clientRooms[client]; !isExist {
+		manager.clientRooms[client] = make(map[string]*Room)
+	}
+	manager.clientRooms[client][id] = room
+	manager.Unlock()
+
+	manager.server.OnRoomJoin(room, client)
+	return nil
+}
+
+// 離開房間
+func (manager *RoomManager) Leave(id string, client *SocketClient) error {
+	manager.Lock()
+	room, isExist := manager.rooms[id]
+	if !isExist {
+		manager.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoomNotExist, id)
+	}
+
+	room.Lock()
+	if !room.members[client] {
+		room.Unlock()
+		manager.Unlock()
+		return fmt.Errorf("%w: %v", ErrRoomNotJoined, id)
+	}
+	delete(room.members, client)
+	room.Unlock()
+
+	manager.removeClientRoom(client, id)
+	manager.Unlock()
+
+	manager.server.OnRoomLeave(room, client)
+	return nil
+}
+
+// 取得客戶端所在的房間
+func (manager *RoomManager) RoomsOf(client *SocketClient) []*Room {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	rooms := make([]*Room, 0, len(manager.clientRooms[client]))
+	for _, room := range manager.clientRooms[client] {
+		rooms = append(rooms, room)
+	}
+
+	return rooms
+}
+
+// 客戶端斷線時離開所有房間
+func (manager *RoomManager) leaveAll(client *SocketClient) {
+	for _, room := range manager.RoomsOf(client) {
+		if err := manager.Leave(room.ID(), client); err != nil {
+			manager.server.logger.Warn(fmt.Sprintf("Client %v leave room %v fail. %v", client.ID(), room.ID(), err.Error()))
+		}
+	}
+}
+
+// 移除客戶端的房間紀錄，呼叫前必須持有鎖
+func (manager *RoomManager) removeClientRoom(client *SocketClient, id string) {
+	rooms, isExist := manager.clientRooms[client]
+	if !isExist {
+		return
+	}
+
+	delete(rooms, id)
+	if len(rooms) == 0 {
+		delete(manager.clientRooms, client)
+	}
+}
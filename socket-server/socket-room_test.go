@@ -0,0 +1,156 @@
+package socketserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 記錄房間事件的流程器
+type roomOperation struct {
+	echoOperation
+	sync.Mutex
+
+	events []string
+}
+
+func (op *roomOperation) record(event string) error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.events = append(op.events, event)
+	return nil
+}
+
+func (op *roomOperation) OnRoomCreate(room *Room) error  { return op.record("create:" + room.ID()) }
+func (op *roomOperation) OnRoomDestroy(room *Room) error { return op.record("destroy:" + room.ID()) }
+func (op *roomOperation) OnRoomJoin(room *Room, _ *SocketClient) error {
+	return op.record("join:" + room.ID())
+}
+func (op *roomOperation) OnRoomLeave(room *Room, _ *SocketClient) error {
+	return op.record("leave:" + room.ID())
+}
+
+func TestRoom(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	op := &roomOperation{echoOperation: echoOperation{opCode: OperationCode(2)}}
+	server.AddOperation(op)
+	server.listen()
+
+	conns := make([]net.Conn, 2)
+	for i := range conns {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+
+	clients := waitTestClients(t, server, len(conns))
+	manager := server.RoomManager
+
+	room, err := manager.CreateRoom("lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = manager.CreateRoom("lobby"); !errors.Is(err, ErrRoomExist) {
+		t.Fatalf("duplicate room should fail. %v", err)
+	}
+
+	for _, client := range clients {
+		if err = manager.Join("lobby", client); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = manager.Join("lobby", clients[0]); !errors.Is(err, ErrRoomJoined) {
+		t.Fatalf("duplicate join should fail. %v", err)
+	}
+
+	if sent, err := room.Broadcast(OperationCode(2), CommandCode(1), ReqData{DataCode(0): "hi"}); err != nil || sent != 2 {
+		t.Fatalf("room broadcast fail. sent = %v, err = %v", sent, err)
+	}
+
+	for _, conn := range conns {
+		if res := readTestResponse(t, conn, NewPacket(nil)); res.CommandCode() != CommandCode(1) {
+			t.Fatalf("room broadcast data mismatch. %+v", res)
+		}
+	}
+
+	// 斷線的客戶端自動離開房間
+	for _, conn := range conns {
+		if conn.LocalAddr().String() == clients[0].RemoteAddr().String() {
+			conn.Close()
+		}
+	}
+
+	for retry := 0; room.Has(clients[0]); retry++ {
+		if retry > 100 {
+			t.Fatal("disconnected client still in room")
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	if rooms := manager.RoomsOf(clients[1]); len(rooms) != 1 || rooms[0] != room {
+		t.Fatalf("rooms of client mismatch. %v", rooms)
+	}
+
+	if err = manager.DestroyRoom("lobby"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manager.RoomsOf(clients[1])) != 0 || room.Count() != 0 {
+		t.Fatal("members not removed after destroy")
+	}
+
+	op.Lock()
+	defer op.Unlock()
+	expect := []string{"create:lobby", "join:lobby", "join:lobby", "leave:lobby", "destroy:lobby"}
+	if len(op.events) != len(expect) {
+		t.Fatalf("room events mismatch. %v", op.events)
+	}
+	for i := range expect {
+		if op.events[i] != expect[i] {
+			t.Fatalf("room events mismatch. %v", op.events)
+		}
+	}
+}
+
+func TestRoomJoinDuringClose(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	manager := server.RoomManager
+	room, err := manager.CreateRoom("lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 加入與關閉同時進行，關閉後客戶端不可留在房間內
+	for i := 0; i < 200; i++ {
+		conn, peer := net.Pipe()
+		client := NewClient("racer", server, server.ctx, conn)
+
+		joined := make(chan error, 1)
+		go func() {
+			joined <- manager.Join(room.ID(), client)
+		}()
+		client.Close(ErrClientStop)
+		err := <-joined
+		peer.Close()
+
+		if err != nil && !errors.Is(err, ErrClientStop) {
+			t.Fatal(err)
+		}
+
+		if room.Has(client) || len(manager.RoomsOf(client)) > 0 {
+			t.Fatalf("closed client still in room. round = %v", i)
+		}
+	}
+}
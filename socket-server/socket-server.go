@@ -2,10 +2,17 @@ package socketserver
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"sync"
 	"syscall"
 	"time"
 
@@ -13,93 +20,256 @@ import (
 	commonsystem "github.com/andy2kuo/AndyGameServerGo/common-system"
 	"github.com/andy2kuo/AndyGameServerGo/database"
 	"github.com/andy2kuo/AndyGameServerGo/logger"
+	"github.com/go-redis/redis/v8"
+	"github.com/xtaci/kcp-go/v5"
 )
 
 // 伺服器
 type SocketServer struct {
-	listener    *net.TCPListener         // 伺服器監聽端
-	client_list map[string]*SocketClient // 已連接客戶端列表
+	listener    *net.TCPListener // 伺服器監聽端
+	wsListener  net.Listener     // WebSocket 監聽端
+	wsServer    *http.Server     // WebSocket 服務
+	kcpListener *kcp.Listener    // KCP 監聽端
+	tlsConfig   *tls.Config      // TLS 設定，未啟用時為 nil
+	certLoader  *certLoader
+	codec       ICodec // 預設請求資料編碼器
 	operations  map[OperationCode]IOperation
-	logger      *logger.Logger
-	ctx         context.Context
-	cancel      context.CancelFunc
-	serialNum   uint64
-	mongoConn   *database.MongoConnection
-	redisConn   *database.RedisConnection
-	env         string
-
-	SystemManager *commonsystem.CommonSystemManager
-	AppSetting    *AppSetting
+	unordered   map[OperationCode]bool // 不需依序執行的流程
+	preAuth     map[OperationCode]bool // 可在登入前執行的流程
+	jobs        chan operationJob      // 工作池佇列，不限制工作數量時為 nil
+	timeouts    map[OperationCode]time.Duration
+	opLimits    map[OperationCode]RateLimit // 各流程的限流規則
+	cmdLimits   map[commandKey]RateLimit    // 各流程指令的限流規則
+	limitStats  RateLimitStats
+	limitLock   sync.Mutex
+
+	handshakeKey ed25519.PrivateKey // 簽署金鑰交換的私鑰，未設定時為 nil
+
+	middlewares    []Middleware
+	opMiddlewares  map[OperationCode][]Middleware
+	cmdMiddlewares map[commandKey][]Middleware
+	logger         *logger.Logger
+	ctx            context.Context
+	cancel         context.CancelFunc
+	acceptLock     sync.Mutex
+	listenLock     sync.Mutex
+	sessions       map[string]*SocketClient // 恢復連線憑證對應的客戶端
+	sessionLock    sync.Mutex
+	serialNum      uint64
+	crossDay       time.Time
+
+	runLock      sync.RWMutex
+	running      sync.WaitGroup // 執行中的流程
+	draining     bool           // 關閉中，不再執行新的流程
+	shutdownOnce sync.Once
+	done         chan struct{} // 關閉完成通知
+	flushAbort   chan struct{} // 關閉期限已到，客戶端不再等待寫出佇列
+	abortOnce    sync.Once
+	mongoConn    *database.MongoConnection
+	redisConn    *database.RedisConnection
+	env          string
+
+	nodeID       string                   // 叢集中的節點編號
+	clusterRedis *redis.Client            // 記錄玩家登入節點，未設定時為 nil
+	logins       map[string]*SocketClient // 本節點玩家編號對應的客戶端
+	loginLock    sync.Mutex
+
+	SystemManager  *commonsystem.CommonSystemManager
+	RoomManager    *RoomManager
+	ClientRegistry *ClientRegistry // 已連接客戶端列表
+	AppSetting     *AppSetting
 }
 
-func (server SocketServer) Environment() string {
+func (server *SocketServer) Environment() string {
 	return server.env
 }
 
+// 取得 TCP 監聽位址，Port 設定為 0 時可取得系統分配的埠號
+func (server *SocketServer) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
 // 啟動
 func (server *SocketServer) Start() {
-	var cross__day_time time.Time
+	server.logger.Info("Socket Server Start!")
+	year, month, day := time.Now().Date()
+	server.crossDay = time.Date(year, month, day+1, 0, 0, 0, 0, time.Now().Location())
 
-	go func() {
-		server.logger.Info("Socket Server Start!")
-		year, month, day := time.Now().Date()
-		cross__day_time = time.Date(year, month, day+1, 0, 0, 0, 0, time.Now().Location())
+	server.SystemManager.OnServerStart()
+
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnServerStart(); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation Start error. Op code = %v, error message => %v", op.GetOperationCode(), err.Error()))
+			}
+		}
+	}
 
-		server.SystemManager.OnServerStart()
+	server.listen()
 
-		if len(server.operations) > 0 {
-			for _, op := range server.operations {
-				if err := op.OnServerStart(); err != nil {
-					server.logger.Error(fmt.Sprintf("Operation Start error. Op code = %v, error message => %v", op.GetOperationCode(), err.Error()))
+	osNotify := make(chan os.Signal, 1)
+	signal.Notify(osNotify, server.osSignals()...)
+	defer signal.Stop(osNotify)
+
+	for {
+		select {
+		case signal := <-osNotify:
+			if signal == syscall.SIGHUP {
+				// 重新讀取憑證
+				if err := server.ReloadCertificate(); err != nil {
+					server.logger.Error(fmt.Sprintf("TLS certificate reload fail. error message => %v", err.Error()))
 				}
+				continue
+			}
+
+			server.logger.Warn(fmt.Sprintf("Get os notify. On signal: %v", signal.String()))
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(server.AppSetting.Server.ShutdownTimeOut))
+			err := server.Shutdown(ctx)
+			cancel()
+
+			if err != nil {
+				server.logger.Error(fmt.Sprintf("Socket Server shutdown not clean. error message => %v", err.Error()))
 			}
+			return
+		case <-server.done:
+			// 已由 Shutdown 關閉
+			return
+		}
+	}
+}
+
+// 伺服器處理的系統訊號，啟用 TLS 時以 SIGHUP 重新讀取憑證，未啟用時 SIGHUP 維持預設行為
+func (server *SocketServer) osSignals() []os.Signal {
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+	if server.certLoader != nil {
+		signals = append(signals, syscall.SIGHUP)
+	}
+
+	return signals
+}
+
+// 關閉伺服器: 停止接收連線、通知客戶端、等待執行中的流程，ctx 到期時不再等待，直接關閉剩餘的服務
+func (server *SocketServer) Shutdown(ctx context.Context) (err error) {
+	server.shutdownOnce.Do(func() {
+		defer close(server.done)
+
+		server.logger.Info("Socket Server shutting down")
+		server.closeListeners()
+
+		// 之後收到的請求不再執行
+		server.runLock.Lock()
+		server.draining = true
+		server.runLock.Unlock()
+
+		if message := server.AppSetting.Server.ShutdownMessage; !isSettingEmpty(message) {
+			server.Broadcast(OpCodeSystem, CmdServerClosing, ReqData{DataCodeMessage: message})
+		}
+
+		drained := make(chan struct{})
+		go func() {
+			server.running.Wait()
+			close(drained)
+		}()
+
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+			server.logger.Warn("Socket Server shutdown deadline exceeded, operations still running")
 		}
 
-		for server.listener != nil {
-			new_conn, err := server.listener.AcceptTCP()
+		server.closeClients(ctx)
+		server.close()
+		server.closeDatabase()
+
+		server.logger.Info("Socket Server Stop!")
+	})
+
+	return err
+}
+
+// 開始接收連線
+func (server *SocketServer) listen() {
+	go func(listener *net.TCPListener) {
+		for {
+			new_conn, err := listener.AcceptTCP()
 			if err != nil {
+				if server.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+					return
+				}
 				continue
 			}
 
-			if time.Now().After(cross__day_time) {
-				cross__day_time = cross__day_time.AddDate(0, 0, 1)
-				server.serialNum = 0
+			if server.tlsConfig != nil {
+				server.acceptClient(tls.Server(new_conn, server.tlsConfig))
+			} else {
+				server.acceptClient(new_conn)
 			}
+		}
+	}(server.listener)
 
-			new_client_id := fmt.Sprintf("socket-%v-%v-%v", time.Now().Format("20060102"), new_conn.RemoteAddr().String(), server.serialNum)
-			new_client := NewClient(new_client_id, server, server.ctx, new_conn)
+	if server.wsServer != nil {
+		go func() {
+			server.logger.Info(fmt.Sprintf("WebSocket Server Start! Port: %v, Path: %v", server.AppSetting.Server.WebSocketPort, server.AppSetting.Server.WebSocketPath))
 
-			_, is_id_exist := server.client_list[new_client_id]
-			if is_id_exist {
-				server.logger.Warn(fmt.Sprintf("%v => client id repeated!!", new_client_id))
-				server.client_list[new_client_id].Close(ErrClientIDDuplicate)
-				delete(server.client_list, new_client_id)
+			var wsListener net.Listener = server.wsListener
+			if server.tlsConfig != nil {
+				wsListener = tls.NewListener(wsListener, server.tlsConfig)
 			}
 
-			new_client.StartProcess()
-			server.client_list[new_client_id] = new_client
+			err := server.wsServer.Serve(wsListener)
+			if err != nil && err != http.ErrServerClosed {
+				server.logger.Error(fmt.Sprintf("WebSocket Server stop. error message => %v", err.Error()))
+			}
+		}()
+	}
 
-			server.serialNum++
-		}
-	}()
+	if server.kcpListener != nil {
+		go func(listener *kcp.Listener) {
+			server.logger.Info(fmt.Sprintf("KCP Server Start! Address: %v", listener.Addr().String()))
+			for {
+				new_conn, err := listener.AcceptKCP()
+				if err != nil {
+					if server.ctx.Err() != nil || errors.Is(err, io.ErrClosedPipe) {
+						return
+					}
+					continue
+				}
 
-	osNotify := make(chan os.Signal, 1)
-	signal.Notify(osNotify, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+				server.acceptClient(new_conn)
+			}
+		}(server.kcpListener)
+	}
 
-Loop:
-	for {
-		select {
-		case signal := <-osNotify:
-			server.logger.Warn(fmt.Sprintf("Get os notify. On signal: %v", signal.String()))
-			server.close()
+	server.watchCertificate()
+}
 
-			// 等待五秒鐘再離開，給正在關閉的服務緩衝時間
-			time.Sleep(time.Second * 5)
-			break Loop
-		default:
-			continue
-		}
+// 接收新的客戶端連線，所有傳輸層共用同一套客戶端流程
+func (server *SocketServer) acceptClient(new_conn net.Conn) *SocketClient {
+	server.acceptLock.Lock()
+	defer server.acceptLock.Unlock()
+
+	if time.Now().After(server.crossDay) {
+		server.crossDay = server.crossDay.AddDate(0, 0, 1)
+		server.serialNum = 0
+	}
+
+	new_client_id := fmt.Sprintf("socket-%v-%v-%v", time.Now().Format("20060102"), new_conn.RemoteAddr().String(), server.serialNum)
+	new_client := NewClient(new_client_id, server, server.ctx, new_conn)
+
+	// 先加入列表再開始處理，避免連線立即中斷時無法移除
+	duplicate_client := server.ClientRegistry.add(new_client)
+	if duplicate_client != nil {
+		server.logger.Warn(fmt.Sprintf("%v => client id repeated!!", new_client_id))
+		duplicate_client.Close(ErrClientIDDuplicate)
 	}
+
+	new_client.StartProcess()
+
+	server.serialNum++
+
+	return new_client
 }
 
 // 關閉伺服器
@@ -111,10 +281,7 @@ func (server *SocketServer) close() {
 		}
 
 		// 最後一定要把監聽關閉
-		if server.listener != nil {
-			server.listener.Close()
-			server.listener = nil
-		}
+		server.closeListeners()
 	}()
 
 	// 發送停止通知給底下
@@ -122,7 +289,10 @@ func (server *SocketServer) close() {
 		server.cancel()
 	}
 
-	server.SystemManager.CloseAllSystem()
+	server.closeListeners()
+
+	// 關閉所有客戶端，流程器仍可收到斷線事件
+	server.closeClients(context.Background())
 
 	if len(server.operations) > 0 {
 		for _, op := range server.operations {
@@ -131,10 +301,82 @@ func (server *SocketServer) close() {
 			}
 		}
 	}
+
+	server.SystemManager.CloseAllSystem()
+}
+
+// 停止接收連線
+// 同時關閉所有客戶端，寫出緩慢的客戶端不會拖慢其他客戶端，ctx 結束時放棄寫出剩餘的封包
+func (server *SocketServer) closeClients(ctx context.Context) {
+	var wait sync.WaitGroup
+	for _, client := range server.ClientRegistry.List() {
+		wait.Add(1)
+		go func(client *SocketClient) {
+			defer wait.Done()
+			client.Close(ErrServerShutdown)
+		}(client)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		wait.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return
+	case <-ctx.Done():
+	}
+
+	server.logger.Warn("Socket Server shutdown deadline exceeded, drop pending client writes")
+	server.abortOnce.Do(func() {
+		close(server.flushAbort)
+	})
+	<-closed
+}
+
+func (server *SocketServer) closeListeners() {
+	server.listenLock.Lock()
+	defer server.listenLock.Unlock()
+
+	if server.listener != nil {
+		server.listener.Close()
+		server.listener = nil
+	}
+
+	if server.wsServer != nil {
+		server.wsServer.Close()
+		server.wsServer = nil
+	}
+
+	if server.kcpListener != nil {
+		server.kcpListener.Close()
+		server.kcpListener = nil
+	}
+}
+
+// 中斷資料庫連線
+func (server *SocketServer) closeDatabase() {
+	if server.mongoConn != nil {
+		if err := server.mongoConn.DisconnectAll(); err != nil {
+			server.logger.Error(err.Error())
+		}
+	}
+
+	if server.redisConn != nil {
+		if err := server.redisConn.DisconnectAll(); err != nil {
+			server.logger.Error(err.Error())
+		}
+	}
 }
 
 // 加入流程器
 func (server *SocketServer) AddOperation(op IOperation) error {
+	if op.GetOperationCode() == OpCodeSystem {
+		return fmt.Errorf("%w: %v", ErrOperationCodeReserved, op.GetOperationCode())
+	}
+
 	_, isExist := server.operations[op.GetOperationCode()]
 	if isExist {
 		server.logger.Warn(fmt.Sprintf("Op: %v Duplicate!", op.GetOperationCode()))
@@ -155,6 +397,17 @@ func (server *SocketServer) OnClientConnect(client *SocketClient) {
 	}
 }
 
+// 當有客戶端登入時
+func (server *SocketServer) OnClientAuthenticated(client *SocketClient) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnClientAuthenticated(client); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on client authenticated notify. Op code = %v, error message => %v", op.GetOperationCode(), err.Error()))
+			}
+		}
+	}
+}
+
 // 當有客戶端斷線離開時
 func (server *SocketServer) OnClientDisconnect(client *SocketClient) {
 	if len(server.operations) > 0 {
@@ -166,6 +419,75 @@ func (server *SocketServer) OnClientDisconnect(client *SocketClient) {
 	}
 }
 
+// 當有客戶端在保留期間內恢復連線時
+func (server *SocketServer) OnClientResume(client *SocketClient) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnClientResume(client); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on client resume notify. Op code = %v, error message => %v", op.GetOperationCode(), err.Error()))
+			}
+		}
+	}
+}
+
+// 客戶端正式關閉，移出列表並發出斷線事件
+func (server *SocketServer) onClientClosed(client *SocketClient) {
+	server.dropResumeToken(client)
+
+	server.ClientRegistry.remove(client)
+	server.releaseLogin(client)
+
+	if client.takeDisconnect() {
+		server.OnClientDisconnect(client)
+	}
+
+	server.RoomManager.leaveAll(client)
+}
+
+// 當有房間建立時
+func (server *SocketServer) OnRoomCreate(room *Room) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnRoomCreate(room); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on room create notify. Op code = %v, Room = %v, error message => %v", op.GetOperationCode(), room.ID(), err.Error()))
+			}
+		}
+	}
+}
+
+// 當有房間刪除時
+func (server *SocketServer) OnRoomDestroy(room *Room) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnRoomDestroy(room); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on room destroy notify. Op code = %v, Room = %v, error message => %v", op.GetOperationCode(), room.ID(), err.Error()))
+			}
+		}
+	}
+}
+
+// 當有客戶端加入房間時
+func (server *SocketServer) OnRoomJoin(room *Room, client *SocketClient) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnRoomJoin(room, client); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on room join notify. Op code = %v, Room = %v, error message => %v", op.GetOperationCode(), room.ID(), err.Error()))
+			}
+		}
+	}
+}
+
+// 當有客戶端離開房間時
+func (server *SocketServer) OnRoomLeave(room *Room, client *SocketClient) {
+	if len(server.operations) > 0 {
+		for _, op := range server.operations {
+			if err := op.OnRoomLeave(room, client); err != nil {
+				server.logger.Error(fmt.Sprintf("Operation error on room leave notify. Op code = %v, Room = %v, error message => %v", op.GetOperationCode(), room.ID(), err.Error()))
+			}
+		}
+	}
+}
+
 // 當有用戶事件通知時
 func (server *SocketServer) OnEventNotify(client *SocketClient, sysEvent OperationEvent) {
 	if len(server.operations) > 0 {
@@ -178,36 +500,81 @@ func (server *SocketServer) OnEventNotify(client *SocketClient, sysEvent Operati
 }
 
 // 執行流程
+//
+// 超時或取消時只會取消 ctx，Go 無法強制結束流程，流程必須依 ctx 結束；
+// 流程結束前仍佔用工作者與客戶端信箱的順序，伺服器關閉時也會等待流程結束
 func (server *SocketServer) RunOperation(req *SocketRequest) {
-	defer func() {
-		if r := recover(); r != nil {
-			err := fmt.Errorf("%v", r)
-			server.logger.Error(fmt.Sprintf("Recover!! Operation error. Op code = %v, Cmd code = %v, error message => %v", req.OperationCode(), req.CommandCode(), err.Error()))
-		}
-	}()
+	// 關閉中不再執行新的流程
+	server.runLock.RLock()
+	if server.draining {
+		server.runLock.RUnlock()
+		server.logger.Warn(fmt.Sprintf("Server shutting down, drop request. Op code = %v, Cmd code = %v", req.OperationCode(), req.CommandCode()))
+		return
+	}
+	server.running.Add(1)
+	server.runLock.RUnlock()
+	defer server.running.Done()
+
+	if req.client != nil {
+		defer req.client.finishPreAuth(req)
+	}
 
 	op, isExist := server.operations[req.OperationCode()]
 	if isExist {
-		timeoutChannel := make(chan bool)
+		// 未登入時只執行登入前允許的流程
+		if !server.checkAuth(req) {
+			return
+		}
+
+		// 超時、客戶端斷線或伺服器關閉時取消
+		timeout := server.operationTimeout(req.OperationCode())
+		parent := server.ctx
+		if req.client != nil {
+			parent = req.client.Context()
+		}
+
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		req.ctx = ctx
+
+		timeoutChannel := make(chan bool, 1)
+
+		handler := server.buildHandler(op, req.OperationCode(), req.CommandCode())
 
 		go func() {
-			err := op.Command(req)
+			defer func() {
+				timeoutChannel <- true
+			}()
+
+			// 流程在獨立的 goroutine 執行，panic 必須在此攔截，否則會使程式結束
+			defer func() {
+				if r := recover(); r != nil {
+					server.logger.Error(fmt.Sprintf("Recover!! Operation panic. Op code = %v, Cmd code = %v, error message => %v\n%s", req.OperationCode(), req.CommandCode(), r, debug.Stack()))
+					req.ResponseError(ErrorCodeInternal, "internal error")
+				}
+			}()
+
+			err := handler(ctx, req)
 
 			if err != nil {
 				server.logger.Error(fmt.Sprintf("Operation error. Op code = %v, Cmd code = %v, error message => %v", req.OperationCode(), req.CommandCode(), err.Error()))
 			}
-
-			timeoutChannel <- true
 		}()
 
 		select {
 		case <-timeoutChannel:
 			// 正常執行
 			break
-		case <-time.After(time.Duration(server.AppSetting.Operation.RunMaxTime) * time.Second):
-			// 流程執行超時
-			server.logger.Error(fmt.Sprintf("Operation time out for %v secs. Op code = %v, Cmd code = %v", server.AppSetting.Operation.RunMaxTime, req.OperationCode(), req.CommandCode()))
-			break
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// 流程執行超時
+				server.logger.Error(fmt.Sprintf("Operation time out for %v. Op code = %v, Cmd code = %v", timeout, req.OperationCode(), req.CommandCode()))
+			} else {
+				server.logger.Warn(fmt.Sprintf("Operation cancelled. Op code = %v, Cmd code = %v", req.OperationCode(), req.CommandCode()))
+			}
+
+			// 等待流程依 ctx 結束，避免工作者已釋放但流程仍在背景執行
+			<-timeoutChannel
 		}
 
 	} else {
@@ -215,28 +582,107 @@ func (server *SocketServer) RunOperation(req *SocketRequest) {
 	}
 }
 
-// 產生新的Socket Server
-func NewServer(env string, log *logger.Logger, _mongoConn *database.MongoConnection, _redisConn *database.RedisConnection) (server *SocketServer, err error) {
-	server = &SocketServer{
-		env:           env,
-		client_list:   make(map[string]*SocketClient),
-		logger:        log,
-		operations:    make(map[OperationCode]IOperation),
-		serialNum:     0,
-		mongoConn:     _mongoConn,
-		redisConn:     _redisConn,
-		SystemManager: commonsystem.NewSystemManager(log, _mongoConn, _redisConn),
+// 設定流程的執行時間上限，覆蓋 RunMaxTime，超時時取消流程的 ctx，需在伺服器啟動前設定
+func (server *SocketServer) SetOperationTimeout(opCode OperationCode, timeout time.Duration) {
+	server.timeouts[opCode] = timeout
+}
+
+// 取得流程的執行時間上限
+func (server *SocketServer) operationTimeout(opCode OperationCode) time.Duration {
+	if timeout, isExist := server.timeouts[opCode]; isExist {
+		return timeout
 	}
 
+	return time.Duration(server.AppSetting.Operation.RunMaxTime) * time.Second
+}
+
+// 產生新的Socket Server
+func NewServer(env string, log *logger.Logger, _mongoConn *database.MongoConnection, _redisConn *database.RedisConnection) (server *SocketServer, err error) {
 	var _setting *AppSetting = &AppSetting{}
 	_setting_err := config.GetConfig(env, _setting)
 	if config.IsCreateNew(_setting_err) {
-		server.logger.Info("Create new application setting file")
+		log.Info("Create new application setting file")
+	}
+
+	return newServer(env, log, _mongoConn, _redisConn, _setting)
+}
+
+// 以指定設定產生新的Socket Server，不讀取設定檔，設定中的欄位不會套用預設值
+func NewServerWithSetting(env string, log *logger.Logger, _mongoConn *database.MongoConnection, _redisConn *database.RedisConnection, _setting *AppSetting) (server *SocketServer, err error) {
+	return newServer(env, log, _mongoConn, _redisConn, _setting)
+}
+
+// 依照指定設定產生新的Socket Server
+func newServer(env string, log *logger.Logger, _mongoConn *database.MongoConnection, _redisConn *database.RedisConnection, _setting *AppSetting) (server *SocketServer, err error) {
+	server = &SocketServer{
+		env:            env,
+		ClientRegistry: NewClientRegistry(),
+		done:           make(chan struct{}),
+		flushAbort:     make(chan struct{}),
+		sessions:       make(map[string]*SocketClient),
+		logins:         make(map[string]*SocketClient),
+		logger:         log,
+		operations:     make(map[OperationCode]IOperation),
+		unordered:      make(map[OperationCode]bool),
+		preAuth:        make(map[OperationCode]bool),
+		timeouts:       make(map[OperationCode]time.Duration),
+		opLimits:       make(map[OperationCode]RateLimit),
+		cmdLimits:      make(map[commandKey]RateLimit),
+		limitStats: RateLimitStats{
+			Operation: make(map[OperationCode]uint64),
+			Command:   make(map[OperationCode]map[CommandCode]uint64),
+		},
+		opMiddlewares:  make(map[OperationCode][]Middleware),
+		cmdMiddlewares: make(map[commandKey][]Middleware),
+		serialNum:      0,
+		mongoConn:      _mongoConn,
+		redisConn:      _redisConn,
+		SystemManager:  commonsystem.NewSystemManager(log, _mongoConn, _redisConn),
 	}
 
 	server.AppSetting = _setting
+	server.RoomManager = NewRoomManager(server)
 	server.ctx, server.cancel = context.WithCancel(context.TODO())
 
+	server.codec, err = GetCodec(server.AppSetting.Server.Codec)
+	if err != nil {
+		return server, err
+	}
+
+	_, err = compressionFlag(server.AppSetting.Server.Compression)
+	if err != nil {
+		return server, err
+	}
+
+	cipherID, err := encryptionID(server.AppSetting.Server.Encryption)
+	if err != nil {
+		return server, err
+	}
+
+	if keyFile := server.AppSetting.Server.HandshakeKeyFile; !isSettingEmpty(keyFile) {
+		server.handshakeKey, err = LoadHandshakeKey(keyFile)
+		if err != nil {
+			return server, err
+		}
+	} else if cipherID != 0 {
+		server.logger.Warn("Handshake key not set, encrypted sessions can not prevent man-in-the-middle attack")
+	}
+
+	err = checkQueueFull(server.AppSetting.Operation.QueueFull)
+	if err != nil {
+		return server, err
+	}
+
+	err = checkRateLimit(server.clientRateLimit())
+	if err != nil {
+		return server, err
+	}
+
+	err = server.setupTLS()
+	if err != nil {
+		return server, err
+	}
+
 	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf(":%v", server.AppSetting.Server.Port))
 	if err != nil {
 		return server, err
@@ -249,5 +695,26 @@ func NewServer(env string, log *logger.Logger, _mongoConn *database.MongoConnect
 
 	server.listener = listener
 
+	if server.AppSetting.Server.WebSocketPort > 0 {
+		err = server.listenWebSocket()
+		if err != nil {
+			return server, err
+		}
+	}
+
+	if server.AppSetting.KCP.Port > 0 {
+		err = server.listenKCP(fmt.Sprintf(":%v", server.AppSetting.KCP.Port))
+		if err != nil {
+			return server, err
+		}
+	}
+
+	err = server.setupCluster()
+	if err != nil {
+		return server, err
+	}
+
+	server.startWorkers()
+
 	return server, nil
 }
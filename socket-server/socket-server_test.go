@@ -1,6 +1,8 @@
 package socketserver
 
 import (
+	"context"
+	"net"
 	"testing"
 	"time"
 
@@ -59,3 +61,135 @@ func TestSocketServer(t *testing.T) {
 	t.Log("test over")
 	t.Log((time.Now().UnixNano() - startTime) / int64(time.Second))
 }
+
+// 測試用流程器，將收到的資料原封不動回覆
+type echoOperation struct {
+	BaseOperation
+	opCode OperationCode
+}
+
+func (op *echoOperation) GetOperationCode() OperationCode { return op.opCode }
+func (op *echoOperation) Command(ctx context.Context, req *SocketRequest) error {
+	return req.Response(req.reqData)
+}
+
+// 產生測試用伺服器，監聽隨機埠
+func newTestServer(t *testing.T, options ...func(*AppSetting)) *SocketServer {
+	setting := &AppSetting{
+		Server: ServerSetting{
+			Name:         "Test Server",
+			Environment:  "test",
+			Port:         0,
+			TimeOut:      30,
+			ReadBuffer:   1024,
+			ReadTimeOut:  5,
+			WriteBuffer:  1024,
+			WriteTimeOut: 5,
+			Codec:        CodecJSON,
+		},
+		Protocol: ProtocolSetting{
+			ProtocolVersion:    1,
+			MinProtocolVersion: 1,
+		},
+		Operation: OperationSetting{
+			RunMaxTime:  5,
+			MailboxSize: 64,
+			WorkerCount: 16,
+			QueueSize:   64,
+			QueueFull:   QueueFullPause,
+		},
+		RateLimit: RateLimitSetting{
+			Action: RateLimitDrop,
+		},
+	}
+
+	for _, option := range options {
+		option(setting)
+	}
+
+	server, err := newServer("test", logger.NewLogger("test", "local-test", logger.ERROR), nil, nil, setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = server.AddOperation(&echoOperation{opCode: OperationCode(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+// 等待指定數量的客戶端完成連線
+func waitTestClients(t *testing.T, server *SocketServer, count int) []*SocketClient {
+	var clients []*SocketClient
+	for retry := 0; len(clients) < count; retry++ {
+		if retry > 100 {
+			t.Fatal("clients not connected")
+		}
+		time.Sleep(time.Millisecond * 20)
+
+		clients = clients[:0]
+		for _, client := range server.ClientRegistry.List() {
+			if client.isConnected() {
+				clients = append(clients, client)
+			}
+		}
+	}
+
+	return clients
+}
+
+// 讀取一個回覆封包
+func readTestResponse(t *testing.T, conn net.Conn, packer *Packer) *SocketRequest {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buffer := make([]byte, 1024)
+	for !packer.Done() {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = packer.Add(buffer[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return packer.Get()
+}
+
+func TestResponseRequestID(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 同一毫秒內發出的請求仍以請求編號區分
+	packer := NewPacket(nil)
+	reqTime := time.Now()
+	sent := make(map[ReqID]bool)
+	for id := ReqID(1); id <= 5; id++ {
+		bd, _ := packer.PackFrame(id, reqTime, OperationCode(1), CommandCode(1), ReqData{DataCode(0): int(id)})
+		conn.Write(bd)
+		sent[id] = true
+	}
+
+	for len(sent) > 0 {
+		res := readTestResponse(t, conn, packer)
+		value, _ := res.GetInt64(DataCode(0))
+		if ReqID(value) != res.GetID() || !sent[res.GetID()] {
+			t.Fatalf("response id mismatch. id = %v, data = %v", res.GetID(), value)
+		}
+
+		if res.GetUID() != ReqUID(reqTime.UnixMilli()) {
+			t.Errorf("response time mismatch. %v", res.GetRequestTime())
+		}
+		delete(sent, res.GetID())
+	}
+}
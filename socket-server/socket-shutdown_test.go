@@ -0,0 +1,187 @@
+package socketserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 執行需要一段時間的流程器
+type slowOperation struct {
+	echoOperation
+	sync.Mutex
+
+	delay      time.Duration
+	finishTime time.Time
+	closeTime  time.Time
+}
+
+func (op *slowOperation) Command(ctx context.Context, req *SocketRequest) error {
+	time.Sleep(op.delay)
+
+	op.Lock()
+	op.finishTime = time.Now()
+	op.Unlock()
+
+	return req.Response(req.reqData)
+}
+
+func (op *slowOperation) OnServerClose() error {
+	op.Lock()
+	defer op.Unlock()
+
+	op.closeTime = time.Now()
+	return nil
+}
+
+func startSlowRequest(t *testing.T, delay time.Duration, setting func(*AppSetting)) (*SocketServer, *slowOperation, net.Conn) {
+	server := newTestServer(t, setting)
+	op := &slowOperation{echoOperation: echoOperation{opCode: OperationCode(2)}, delay: delay}
+	server.AddOperation(op)
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitTestClients(t, server, 1)
+
+	bd, _ := NewPacket(nil).PackFrame(1, time.Now(), OperationCode(2), CommandCode(1), ReqData{DataCode(0): "slow"})
+	conn.Write(bd)
+
+	// 等待流程開始執行
+	time.Sleep(time.Millisecond * 50)
+	return server, op, conn
+}
+
+func TestShutdownDrain(t *testing.T) {
+	server, op, conn := startSlowRequest(t, time.Millisecond*300, func(setting *AppSetting) {
+		setting.Server.ShutdownMessage = "maintenance"
+	})
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-server.done:
+	default:
+		t.Fatal("done not closed after shutdown")
+	}
+
+	op.Lock()
+	if op.finishTime.IsZero() || op.closeTime.Before(op.finishTime) {
+		t.Errorf("operation not drained before close. finish = %v, close = %v", op.finishTime, op.closeTime)
+	}
+	op.Unlock()
+
+	// 關閉通知與執行中流程的回覆都應送達
+	packer := NewPacket(nil)
+	received := make(map[CommandCode]bool)
+	for i := 0; i < 2; i++ {
+		res := readTestResponse(t, conn, packer)
+		received[res.CommandCode()] = true
+
+		if res.OperationCode() == OpCodeSystem {
+			if message, _ := res.GetString(DataCodeMessage); message != "maintenance" {
+				t.Errorf("closing message mismatch. %v", message)
+			}
+		}
+	}
+
+	if !received[CmdServerClosing] || !received[CommandCode(1)] {
+		t.Fatalf("frames missing. %v", received)
+	}
+
+	// 重複呼叫直接回傳
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	server, _, conn := startSlowRequest(t, time.Second*2, func(setting *AppSetting) {
+		setting.Server.ShutdownMessage = ""
+	})
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	startTime := time.Now()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown should exceed deadline. %v", err)
+	}
+
+	if time.Since(startTime) > time.Second {
+		t.Fatalf("shutdown wait too long. %v", time.Since(startTime))
+	}
+}
+
+func TestShutdownEmptyMessage(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		// config 會將空白設定轉為 "empty"
+		setting.Server.ShutdownMessage = "empty"
+	})
+	server.listen()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitTestClients(t, server, 1)
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if n, err := conn.Read(buffer); n > 0 || err == nil {
+		t.Fatalf("closing notice sent with empty message. %v bytes", n)
+	}
+}
+
+func TestShutdownSlowClients(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.WriteTimeOut = 3
+		setting.Server.WriteHighWater = 0
+	})
+	server.listen()
+
+	// 連線後不讀取任何資料，寫出佇列會一直卡住
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", server.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+
+	payload := ReqData{DataCode(0): strings.Repeat("x", 4096)}
+	for _, client := range waitTestClients(t, server, 3) {
+		for i := 0; i < 2000; i++ {
+			client.Send(time.Now(), OperationCode(2), CommandCode(1), payload)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+
+	startTime := time.Now()
+	server.Shutdown(ctx)
+
+	if cost := time.Since(startTime); cost > time.Millisecond*1500 {
+		t.Fatalf("shutdown ignore deadline with slow clients. %v", cost)
+	}
+}
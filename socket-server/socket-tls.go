@@ -0,0 +1,179 @@
+package socketserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andy2kuo/AndyGameServerGo/logger"
+)
+
+const (
+	TLSModeOff    = "off"
+	TLSModeTLS    = "tls"
+	TLSModeMutual = "mtls"
+)
+
+// 憑證讀取器，支援不重啟伺服器重新讀取憑證
+type certLoader struct {
+	sync.RWMutex
+
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	logger   *logger.Logger
+}
+
+func newCertLoader(certFile, keyFile string, log *logger.Logger) (*certLoader, error) {
+	loader := &certLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   log,
+	}
+
+	return loader, loader.Reload()
+}
+
+// 重新讀取憑證
+func (loader *certLoader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(loader.certFile, loader.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate fail. %v", err)
+	}
+
+	loader.Lock()
+	defer loader.Unlock()
+
+	loader.cert = &cert
+	loader.modTime = loader.lastModTime()
+
+	return nil
+}
+
+// 若憑證檔案有更新則重新讀取
+func (loader *certLoader) ReloadIfModified() error {
+	loader.RLock()
+	modTime := loader.modTime
+	loader.RUnlock()
+
+	if !loader.lastModTime().After(modTime) {
+		return nil
+	}
+
+	err := loader.Reload()
+	if err == nil {
+		loader.logger.Info("TLS certificate reloaded")
+	}
+
+	return err
+}
+
+// 取得憑證與私鑰檔案中較新的修改時間
+func (loader *certLoader) lastModTime() (modTime time.Time) {
+	for _, file := range []string{loader.certFile, loader.keyFile} {
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime
+}
+
+// 提供給 tls.Config 使用，每次握手都取得最新憑證
+func (loader *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	loader.RLock()
+	defer loader.RUnlock()
+
+	return loader.cert, nil
+}
+
+// 依照設定建立 TLS 設定，TLSMode 為 off 時回傳 nil
+func (server *SocketServer) setupTLS() error {
+	setting := server.AppSetting.Server
+
+	mode := strings.ToLower(setting.TLSMode)
+	switch mode {
+	case TLSModeOff, "", "empty":
+		return nil
+	case TLSModeTLS, TLSModeMutual:
+	default:
+		return fmt.Errorf("%w: %v", ErrTLSModeInvalid, setting.TLSMode)
+	}
+
+	if setting.TLSCertFile == "empty" || setting.TLSKeyFile == "empty" {
+		return ErrTLSCertNotSet
+	}
+
+	loader, err := newCertLoader(setting.TLSCertFile, setting.TLSKeyFile, server.logger)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: loader.GetCertificate,
+	}
+
+	if mode == TLSModeMutual {
+		caData, err := os.ReadFile(setting.TLSClientCAFile)
+		if err != nil {
+			return fmt.Errorf("load tls client ca fail. %v", err)
+		}
+
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caData) {
+			return fmt.Errorf("load tls client ca fail. no certificate found in %v", setting.TLSClientCAFile)
+		}
+
+		tlsConfig.ClientCAs = caPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	server.certLoader = loader
+	server.tlsConfig = tlsConfig
+
+	return nil
+}
+
+// 定時檢查憑證檔案是否更新
+func (server *SocketServer) watchCertificate() {
+	if server.certLoader == nil || server.AppSetting.Server.TLSReloadInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second * time.Duration(server.AppSetting.Server.TLSReloadInterval))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-server.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := server.certLoader.ReloadIfModified(); err != nil {
+					server.logger.Error(fmt.Sprintf("TLS certificate reload fail. error message => %v", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// 重新讀取 TLS 憑證，已建立的連線不受影響
+func (server *SocketServer) ReloadCertificate() error {
+	if server.certLoader == nil {
+		return ErrTLSCertNotSet
+	}
+
+	err := server.certLoader.Reload()
+	if err == nil {
+		server.logger.Info("TLS certificate reloaded")
+	}
+
+	return err
+}
@@ -0,0 +1,135 @@
+package socketserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 產生自簽憑證
+func writeTestCertificate(t *testing.T, dir string, serial int64) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return certFile, keyFile
+}
+
+func TestTLSEchoAndReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir, 1)
+
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.TLSMode = TLSModeTLS
+		setting.Server.TLSCertFile = certFile
+		setting.Server.TLSKeyFile = keyFile
+	})
+	defer server.close()
+	server.listen()
+
+	dial := func() *tls.Conn {
+		conn, err := tls.Dial("tcp", server.listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return conn
+	}
+
+	conn := dial()
+	defer conn.Close()
+
+	req := NewSocketRequest(OperationCode(1), CommandCode(3))
+	req.Set(DataCode(0), "secret")
+
+	packer := NewPacket(nil)
+	bd, _ := packer.PackRequest(req)
+	if _, err := conn.Write(bd); err != nil {
+		t.Fatal(err)
+	}
+
+	res := readTestResponse(t, conn, packer)
+	if data, _ := res.Get(DataCode(0)); data != "secret" {
+		t.Errorf("echo data mismatch. %v", data)
+	}
+
+	if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 1 {
+		t.Errorf("certificate serial mismatch. %v", serial)
+	}
+
+	writeTestCertificate(t, dir, 2)
+	if err := server.ReloadCertificate(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloadConn := dial()
+	defer reloadConn.Close()
+	if serial := reloadConn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 2 {
+		t.Errorf("certificate not reloaded. serial = %v", serial)
+	}
+}
+
+func TestTLSReloadSignal(t *testing.T) {
+	hasSIGHUP := func(server *SocketServer) bool {
+		for _, sig := range server.osSignals() {
+			if sig == syscall.SIGHUP {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 未啟用 TLS 時不攔截 SIGHUP
+	plain := newTestServer(t)
+	defer plain.close()
+	if hasSIGHUP(plain) {
+		t.Fatal("SIGHUP subscribed without TLS")
+	}
+
+	certFile, keyFile := writeTestCertificate(t, t.TempDir(), 1)
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.TLSMode = TLSModeTLS
+		setting.Server.TLSCertFile = certFile
+		setting.Server.TLSKeyFile = keyFile
+	})
+	defer server.close()
+	if !hasSIGHUP(server) {
+		t.Fatal("SIGHUP not subscribed with TLS")
+	}
+}
@@ -0,0 +1,69 @@
+package socketserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocket 連線
+//
+// 每個 Write 會送出一個 Binary Frame，Read 則將收到的 Frame 依序讀成位元流，
+// 因此 Packer 的封包格式與 TCP 完全相同
+type wsConn struct {
+	*websocket.Conn
+	remoteAddr net.Addr
+}
+
+// 伺服器端的 websocket.Conn 會回傳 Origin，這裡改回傳實際的客戶端位址
+func (conn *wsConn) RemoteAddr() net.Addr {
+	return conn.remoteAddr
+}
+
+// WebSocket 客戶端位址
+type wsAddr string
+
+func (addr wsAddr) Network() string {
+	return "websocket"
+}
+
+func (addr wsAddr) String() string {
+	return string(addr)
+}
+
+// 建立 WebSocket 監聽
+func (server *SocketServer) listenWebSocket() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", server.AppSetting.Server.WebSocketPort))
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(server.AppSetting.Server.WebSocketPath, websocket.Server{
+		Handler: server.handleWebSocket,
+	})
+
+	server.wsListener = listener
+	server.wsServer = &http.Server{
+		Handler: mux,
+	}
+
+	return nil
+}
+
+// 處理 WebSocket 連線，連線存活期間不可離開此函式
+func (server *SocketServer) handleWebSocket(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+
+	new_client := server.acceptClient(&wsConn{
+		Conn:       ws,
+		remoteAddr: wsAddr(ws.Request().RemoteAddr),
+	})
+
+	select {
+	case <-new_client.Closed():
+	case <-server.ctx.Done():
+	}
+}
@@ -0,0 +1,48 @@
+package socketserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketEcho(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	httpServer := httptest.NewServer(websocket.Server{Handler: server.handleWebSocket})
+	defer httpServer.Close()
+
+	ws, err := websocket.Dial(strings.Replace(httpServer.URL, "http", "ws", 1), "", httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+
+	req := NewSocketRequest(OperationCode(1), CommandCode(7))
+	req.Set(DataCode(0), "hello")
+
+	packer := NewPacket(nil)
+	bd, err := packer.PackRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ws.Write(bd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := readTestResponse(t, ws, packer)
+	if res.CommandCode() != CommandCode(7) {
+		t.Errorf("command code mismatch. %v", res.CommandCode())
+	}
+
+	data, _ := res.Get(DataCode(0))
+	if data != "hello" {
+		t.Errorf("echo data mismatch. %v", data)
+	}
+}
@@ -0,0 +1,142 @@
+package socketserver
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// 等待寫出的封包佇列，每個連線一個，由寫出工作依序寫入連線
+type writeQueue struct {
+	sync.Mutex
+
+	frames [][]byte
+	size   int  // 等待寫出的位元組數
+	closed bool // 不再接受新的封包
+	notify chan struct{}
+	done   chan struct{} // 寫出工作結束通知
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// 加入封包，回傳等待寫出的位元組數，佇列已關閉時回傳 false
+func (queue *writeQueue) push(frame []byte) (int, bool) {
+	queue.Lock()
+	if queue.closed {
+		queue.Unlock()
+		return 0, false
+	}
+
+	queue.frames = append(queue.frames, frame)
+	queue.size += len(frame)
+	size := queue.size
+	queue.Unlock()
+
+	queue.wake()
+	return size, true
+}
+
+// 取出等待寫出的封包，總長度不超過 limit，單一封包超過時仍會取出，佇列已關閉時 isOpen 為 false
+func (queue *writeQueue) take(limit int) (frames [][]byte, isOpen bool) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	total, count := 0, 0
+	for _, frame := range queue.frames {
+		if count > 0 && total+len(frame) > limit {
+			break
+		}
+		total += len(frame)
+		count++
+	}
+
+	frames = queue.frames[:count:count]
+	queue.frames = queue.frames[count:]
+	if len(queue.frames) == 0 {
+		queue.frames = nil
+	}
+	queue.size -= total
+
+	return frames, !queue.closed
+}
+
+// 關閉佇列，discard 為 true 時捨棄尚未寫出的封包，否則寫出後才結束
+func (queue *writeQueue) close(discard bool) {
+	queue.Lock()
+	queue.closed = true
+	if discard {
+		queue.frames = nil
+		queue.size = 0
+	}
+	queue.Unlock()
+
+	queue.wake()
+}
+
+func (queue *writeQueue) wake() {
+	select {
+	case queue.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 將佇列中的封包合併後寫入連線，佇列關閉且寫完或寫入失敗時結束
+func (client *SocketClient) writeLoop(conn net.Conn, queue *writeQueue) {
+	defer close(queue.done)
+
+	setting := client.server.AppSetting.Server
+	buffer := make([]byte, 0, setting.WriteCoalesce)
+	for {
+		frames, isOpen := queue.take(setting.WriteCoalesce)
+		if len(frames) == 0 {
+			if !isOpen {
+				return
+			}
+
+			<-queue.notify
+			continue
+		}
+
+		buffer = buffer[:0]
+		for _, frame := range frames {
+			buffer = append(buffer, frame...)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(time.Second * time.Duration(setting.WriteTimeOut)))
+		if _, err := conn.Write(buffer); err != nil {
+			client.logger.Error(fmt.Sprintf("Client send data fail, error => %v", err.Error()))
+
+			// 關閉客戶端時會等待此工作結束，需在其他 goroutine 處理斷線
+			queue.close(true)
+			go client.disconnect(conn, err)
+			return
+		}
+	}
+}
+
+// 為連線建立寫出佇列並啟動寫出工作，呼叫前必須持有鎖
+func (client *SocketClient) startWriter(conn net.Conn) {
+	client.outbox = newWriteQueue()
+	go client.writeLoop(conn, client.outbox)
+}
+
+// 等待寫出佇列中的封包寫完，最多等待 WriteTimeOut 秒，伺服器關閉期限已到時不再等待
+func (client *SocketClient) flushWriter(queue *writeQueue) {
+	queue.close(false)
+
+	timer := time.NewTimer(time.Second * time.Duration(client.server.AppSetting.Server.WriteTimeOut))
+	defer timer.Stop()
+
+	select {
+	case <-queue.done:
+	case <-timer.C:
+		client.logger.Warn(fmt.Sprintf("Client %v flush write queue time out", client.id))
+	case <-client.server.flushAbort:
+	}
+}
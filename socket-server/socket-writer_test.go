@@ -0,0 +1,118 @@
+package socketserver
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteQueueCoalesce(t *testing.T) {
+	queue := newWriteQueue()
+	for i := 0; i < 3; i++ {
+		queue.push(make([]byte, 10))
+	}
+
+	// 合併上限內的封包一次取出
+	if frames, isOpen := queue.take(25); len(frames) != 2 || !isOpen || queue.size != 10 {
+		t.Fatalf("take mismatch. frames = %v, size = %v", len(frames), queue.size)
+	}
+
+	// 超過上限的單一封包仍會取出
+	queue.push(make([]byte, 50))
+	if frames, _ := queue.take(25); len(frames) != 1 || len(frames[0]) != 10 {
+		t.Fatalf("take mismatch. frames = %v", len(frames))
+	}
+	if frames, _ := queue.take(25); len(frames) != 1 || len(frames[0]) != 50 {
+		t.Fatalf("oversize frame not taken. frames = %v", len(frames))
+	}
+
+	queue.push(make([]byte, 10))
+	queue.close(false)
+	if _, isOpen := queue.push(make([]byte, 10)); isOpen {
+		t.Fatal("push after close accepted")
+	}
+
+	// 關閉後仍需寫出剩餘的封包
+	if frames, isOpen := queue.take(25); len(frames) != 1 || isOpen {
+		t.Fatalf("remaining frames mismatch. frames = %v, open = %v", len(frames), isOpen)
+	}
+}
+
+func TestWriteHighWater(t *testing.T) {
+	server := newTestServer(t, func(setting *AppSetting) {
+		setting.Server.WriteHighWater = 65536
+		setting.Server.WriteCoalesce = 65536
+	})
+	defer server.close()
+
+	server.listen()
+
+	// 連線後不讀取任何資料
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := waitTestClients(t, server, 1)[0]
+
+	payload := ReqData{DataCode(0): strings.Repeat("x", 4096)}
+	for i := 0; ; i++ {
+		if i > 10000 {
+			t.Fatal("write queue never reached high water mark")
+		}
+
+		err = client.Send(time.Now(), OperationCode(2), CommandCode(1), payload)
+		if err != nil {
+			break
+		}
+	}
+
+	if !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("send error mismatch. %v", err)
+	}
+
+	select {
+	case <-client.Closed():
+	case <-time.After(time.Second * 5):
+		t.Fatal("slow consumer not closed")
+	}
+
+	if !errors.Is(client.DisconnectReason(), ErrSlowConsumer) {
+		t.Fatalf("disconnect reason mismatch. %v", client.DisconnectReason())
+	}
+}
+
+// 寫入一律失敗的連線
+type failWriteConn struct {
+	net.Conn
+}
+
+func (conn failWriteConn) Write([]byte) (int, error) {
+	return 0, errors.New("write broken")
+}
+
+func TestWriteFailDisconnect(t *testing.T) {
+	server := newTestServer(t)
+	defer server.close()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	client := NewClient("broken", server, server.ctx, failWriteConn{conn})
+	client.StartProcess()
+	client.Send(time.Now(), OperationCode(2), CommandCode(1), ReqData{})
+
+	// 寫入失敗時直接斷線，不等待讀取端逾時
+	select {
+	case <-client.Closed():
+	case <-time.After(time.Second * 3):
+		t.Fatal("client not closed after write fail")
+	}
+
+	if reason := client.DisconnectReason(); reason == nil || reason.Error() != "write broken" {
+		t.Fatalf("disconnect reason mismatch. %v", reason)
+	}
+}